@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/keyring"
+	"github.com/cloudbridgeuy/puper/pkg/styles"
+	pterm "github.com/cloudbridgeuy/puper/pkg/term"
+)
+
+// authCmd groups the commands that manage the credentials in the keyring.
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the credentials stored in the OS keyring",
+	Long: `
+Store the credentials of a site in the OS keyring, so they never appear in
+a config file or in the shell history. The --auth, --bearer and --cookies
+flags, or their config keys, read them when set to 'keyring', for the host
+of the page, or to 'keyring:HOST'.
+
+  puper auth set example.com --kind bearer
+  puper --no-browser --bearer keyring https://example.com/api/page`,
+}
+
+// authSetCmd stores a credential.
+var authSetCmd = &cobra.Command{
+	Use:   "set HOST",
+	Short: "Store the credential of a host",
+	Long: `
+Store the credential of a host in the OS keyring. The credential is read
+from the terminal without echoing it, or from stdin when it isn't one:
+USER:PASSWORD for --kind auth, the token for --kind bearer and a Cookie
+header, as in 'name=value; other=value', for --kind cookies.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setCredential(cmd, args[0]); err != nil {
+			errors.HandleError(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// authDeleteCmd removes a credential.
+var authDeleteCmd = &cobra.Command{
+	Use:   "delete HOST",
+	Short: "Remove the credential of a host",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		kind, err := credentialKind(cmd)
+		if err == nil {
+			err = keyring.Delete(keyring.NormalizeHost(args[0]), kind)
+		}
+		if err != nil {
+			errors.HandleError(errors.NewPuperError(err, "Can't delete the credential"))
+			os.Exit(1)
+		}
+
+		styles.PrintConfirmation("deleted", kind+" credential of "+keyring.NormalizeHost(args[0]))
+	},
+}
+
+// setCredential reads the credential and stores it for the host.
+func setCredential(cmd *cobra.Command, host string) error {
+	kind, err := credentialKind(cmd)
+	if err != nil {
+		return err
+	}
+
+	host = keyring.NormalizeHost(host)
+	if host == "" {
+		return errors.NewPuperError(fmt.Errorf("empty host"), "Invalid host")
+	}
+
+	var secret string
+	if pterm.IsInputTTY() {
+		fmt.Fprintf(os.Stderr, "%s credential for %s: ", kind, host)
+		data, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return errors.NewPuperError(err, "Can't read the credential")
+		}
+		secret = string(data)
+	} else {
+		data, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return errors.NewPuperError(err, "Can't read the credential")
+		}
+		secret = string(data)
+	}
+
+	secret = strings.TrimRight(secret, "\r\n")
+	switch {
+	case secret == "":
+		return errors.NewPuperError(fmt.Errorf("empty credential"), "Invalid credential")
+	case kind == keyring.KindAuth && !strings.Contains(secret, ":"):
+		return errors.NewPuperError(fmt.Errorf("expected USER:PASSWORD"), "Invalid credential")
+	}
+
+	if err := keyring.Set(host, kind, secret); err != nil {
+		return errors.NewPuperError(err, "Can't store the credential")
+	}
+
+	styles.PrintConfirmation("stored", kind+" credential of "+host)
+	return nil
+}
+
+// credentialKind returns the kind of credential given with --kind.
+func credentialKind(cmd *cobra.Command) (string, error) {
+	kind, err := cmd.Flags().GetString("kind")
+	if err != nil {
+		return "", errors.NewPuperError(err, "Can't get the kind flag")
+	}
+
+	switch kind {
+	case keyring.KindAuth, keyring.KindBearer, keyring.KindCookies:
+		return kind, nil
+	}
+	return "", errors.NewPuperError(fmt.Errorf("unsupported credential kind: %s, expected auth, bearer or cookies", kind), "Invalid kind flag")
+}
+
+func init() {
+	authCmd.PersistentFlags().String("kind", keyring.KindAuth, "Kind of credential, named after the flag reading it: auth, bearer or cookies")
+
+	authCmd.AddCommand(authSetCmd)
+	authCmd.AddCommand(authDeleteCmd)
+	rootCmd.AddCommand(authCmd)
+}
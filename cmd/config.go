@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/cloudbridgeuy/puper/pkg/config"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/styles"
+)
+
+// configCmd groups the commands that deal with the config file.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the puper config file",
+	Long: `
+Manage the puper config file.
+
+The values of the keys taking secrets, URLs and paths, like header, bearer,
+auth, proxy or manifest, can reference environment variables as ${NAME} or
+${NAME:-default}, and $${ escapes a literal ${. The other values, like the
+exec-js scripts, are used as they are.
+
+The auth, bearer and cookies keys can also be set to keyring, to read the
+credential stored for the host of the page with 'puper auth set'.`,
+}
+
+// configValidateCmd strictly validates a config file.
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [FILE]",
+	Short: "Validate a config file",
+	Long: `
+Strictly decode the config file, reporting unknown keys, values of the wrong
+type, invalid selectors, invalid redaction patterns and missing environment
+variables along with their line numbers. Validates the file passed as
+argument, or else every config file puper would load.
+
+Exits with a non-zero status when problems are found.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		paths := configFiles
+		if len(args) > 0 {
+			paths = args
+		}
+
+		if len(paths) == 0 {
+			errors.HandleAsPuperError(fmt.Errorf("no config file found"), "Nothing to validate")
+			os.Exit(1)
+		}
+
+		valid := true
+		for _, path := range paths {
+			problems, err := config.Validate(path)
+			if err != nil {
+				errors.HandleAsPuperError(err, "Can't read the config file")
+				os.Exit(1)
+			}
+
+			if len(problems) == 0 {
+				styles.PrintConfirmation("valid", path)
+				continue
+			}
+
+			valid = false
+			for _, problem := range problems {
+				if problem.Line > 0 {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s:%d: %s\n", path, problem.Line, problem.Message)
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", path, problem.Message)
+				}
+			}
+		}
+
+		if !valid {
+			os.Exit(1)
+		}
+	},
+}
+
+// applyConfig uses the config values as the defaults of the flags that were
+// not set on the command line.
+func applyConfig(flags *pflag.FlagSet) error {
+	keys := config.Keys()
+
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !slices.Contains(keys, f.Name) || !viper.IsSet(f.Name) {
+			return
+		}
+
+		values := []string{viper.GetString(f.Name)}
+		if items, ok := viper.Get(f.Name).([]interface{}); ok {
+			values = []string{}
+			for _, item := range items {
+				values = append(values, fmt.Sprint(item))
+			}
+		}
+
+		for _, value := range values {
+			if config.Expands(f.Name) {
+				if value, err = config.Expand(value); err != nil {
+					err = fmt.Errorf("invalid %s value: %w", f.Name, err)
+					return
+				}
+			}
+			if err = f.Value.Set(value); err != nil {
+				err = fmt.Errorf("invalid %s value: %w (run 'puper config validate' for details)", f.Name, err)
+				return
+			}
+		}
+	})
+
+	return err
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/daemon"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/logger"
+	"github.com/cloudbridgeuy/puper/pkg/styles"
+)
+
+// daemonCmd groups the commands that manage the daemon.
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Manage a daemon that keeps a warm Firefox running",
+}
+
+// daemonStartCmd runs the daemon.
+var daemonStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the daemon",
+	Long: `
+Start geckodriver and Firefox once and keep them running, loading the pages
+submitted with 'puper --daemon URL' through a unix socket. Saves the seconds
+it takes to start Firefox on every invocation.
+
+The daemon runs in the foreground until it gets interrupted or stopped with
+'puper daemon stop'. Pages are loaded one at a time. Once each page is
+loaded, its cookies and storage are cleared and the window gets its size
+back. Firefox is restarted if it dies. The browser keeps the settings it
+was started with, so flags like --proxy, --tor, --header or --user-agent
+can't be used with --daemon.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := startDaemon(cmd); err != nil {
+			errors.HandleError(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// startDaemon reads the flags of the daemon and serves it until it's
+// stopped.
+func startDaemon(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+
+	if err := applyConfig(flags); err != nil {
+		return errors.NewPuperError(err, "Invalid config file")
+	}
+
+	socket, err := flags.GetString("socket")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the socket flag")
+	}
+
+	port, err := flags.GetInt("port")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the port flag")
+	}
+
+	bind, err := flags.GetString("bind")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the bind flag")
+	}
+
+	binary, err := flags.GetString("firefox-binary")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the firefox-binary flag")
+	}
+
+	driver, err := flags.GetString("geckodriver-binary")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the geckodriver-binary flag")
+	}
+
+	driverArgs, err := flags.GetStringArray("geckodriver-arg")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the geckodriver-arg flag")
+	}
+
+	consoleLog, err := flags.GetBool("console-log")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the console-log flag")
+	}
+
+	languages, err := flags.GetStringSlice("lang")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the lang flag")
+	}
+
+	if languages, err = parseLanguages(languages); err != nil {
+		return errors.NewPuperError(err, "Invalid lang flag")
+	}
+
+	verbose, err := flags.GetBool("verbose")
+	if err != nil {
+		return errors.NewPuperError(err, "Can't get the verbose flag")
+	}
+
+	if verbose {
+		logger.Verbose()
+	}
+
+	builder := browser.NewBuilder().
+		WithPort(port).
+		WithBind(bind).
+		WithBinary(binary).
+		WithDriver(driver, driverArgs).
+		WithConsoleLog(consoleLog)
+	if len(languages) > 0 {
+		builder.WithLanguages(languages)
+	}
+
+	return daemon.Serve(cmd.Context(), socket, builder.Build())
+}
+
+// daemonStopCmd stops a running daemon.
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		socket, err := cmd.Flags().GetString("socket")
+		if err != nil {
+			errors.HandleError(errors.NewPuperError(err, "Can't get the socket flag"))
+			os.Exit(1)
+		}
+
+		if err := daemon.Stop(cmd.Context(), socket); err != nil {
+			errors.HandleError(err)
+			os.Exit(1)
+		}
+
+		styles.PrintConfirmation("stopped", socket)
+	},
+}
+
+func init() {
+	daemonCmd.PersistentFlags().String("socket", daemon.DefaultSocket(), "Unix socket the daemon listens on")
+
+	daemonStartCmd.Flags().Int("port", 0, "WebDriver server port. A random one will be selected if empty.")
+	daemonStartCmd.Flags().String("bind", "127.0.0.1", "Address geckodriver listens on")
+	daemonStartCmd.Flags().String("firefox-binary", "/Applications/Firefox.app/Contents/MacOS/firefox", "Firefox binary path")
+	daemonStartCmd.Flags().String("geckodriver-binary", "", "Geckodriver binary path. Looked up in the PATH if empty")
+	daemonStartCmd.Flags().StringArray("geckodriver-arg", []string{}, "Extra argument for geckodriver, like --log-level=trace. Can be repeated")
+	daemonStartCmd.Flags().StringSlice("lang", []string{}, "Languages Firefox requests the pages in, by preference, like es-UY,en")
+	daemonStartCmd.Flags().Bool("console-log", false, "Capture the browser console messages of every page")
+	daemonStartCmd.Flags().Bool("verbose", false, "Verbose output")
+
+	daemonCmd.AddCommand(daemonStartCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
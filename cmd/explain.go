@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/keyring"
+)
+
+// plan describes what a puper invocation would do, as printed by `--explain`.
+type plan struct {
+	Input        inputPlan  `yaml:"input"`
+	Fetch        *fetchPlan `yaml:"fetch,omitempty"`
+	Config       []string   `yaml:"config"`
+	Charset      string     `yaml:"charset"`
+	AutoRoute    bool       `yaml:"auto-route"`
+	Timeout      string     `yaml:"timeout,omitempty"`
+	Selectors    []string   `yaml:"selectors"`
+	OnNoMatch    []string   `yaml:"on-no-match"`
+	Sections     string     `yaml:"section-matching,omitempty"`
+	Transforms   []string   `yaml:"transforms"`
+	Plugins      []string   `yaml:"plugins"`
+	Filters      []string   `yaml:"filter-commands"`
+	Script       string     `yaml:"script,omitempty"`
+	Output       outputPlan `yaml:"output"`
+	Destinations []string   `yaml:"destinations"`
+}
+
+type inputPlan struct {
+	Source   string `yaml:"source"`
+	Location string `yaml:"location,omitempty"`
+	HAR      string `yaml:"har,omitempty"`
+}
+
+type fetchPlan struct {
+	Strategy      string   `yaml:"strategy"`
+	Binary        string   `yaml:"binary"`
+	Driver        string   `yaml:"driver,omitempty"`
+	Port          string   `yaml:"port"`
+	Bind          string   `yaml:"bind,omitempty"`
+	Remote        string   `yaml:"remote,omitempty"`
+	Startup       string   `yaml:"startup-timeout,omitempty"`
+	Wait          string   `yaml:"wait"`
+	Proxy         string   `yaml:"proxy,omitempty"`
+	Impersonate   string   `yaml:"impersonate,omitempty"`
+	Headers       []string `yaml:"headers,omitempty"`
+	UserAgent     string   `yaml:"user-agent,omitempty"`
+	Viewport      string   `yaml:"viewport,omitempty"`
+	Languages     []string `yaml:"lang,omitempty"`
+	Login         string   `yaml:"login-script,omitempty"`
+	Scripts       int      `yaml:"exec-js,omitempty"`
+	PDF           string   `yaml:"pdf,omitempty"`
+	Click         []string `yaml:"click,omitempty"`
+	Scroll        string   `yaml:"scroll,omitempty"`
+	Auth          string   `yaml:"auth,omitempty"`
+	Cookies       string   `yaml:"cookies,omitempty"`
+	MemoryLimit   string   `yaml:"memory-limit,omitempty"`
+	Nice          int      `yaml:"nice,omitempty"`
+	ConsoleLog    bool     `yaml:"console-log"`
+	FailOnJSError string   `yaml:"fail-on-js-error,omitempty"`
+	Perf          bool     `yaml:"perf"`
+}
+
+type outputPlan struct {
+	Format     string `yaml:"format"`
+	Attributes bool   `yaml:"attributes"`
+	Span       bool   `yaml:"span"`
+	Ruby       string `yaml:"ruby"`
+	BidiMarks  bool   `yaml:"bidi-marks"`
+	PDF        string `yaml:"pdf"`
+	Figures    string `yaml:"md-figures,omitempty"`
+	Details    string `yaml:"md-details,omitempty"`
+	Anchors    string `yaml:"md-anchors,omitempty"`
+	Cite       string `yaml:"cite,omitempty"`
+	OGImage    string `yaml:"og-image,omitempty"`
+	Favicon    string `yaml:"favicon,omitempty"`
+	Manifest   string `yaml:"manifest,omitempty"`
+}
+
+// newPlan resolves the execution plan for the given options.
+func newPlan(o options) plan {
+	p := plan{
+		Config:       configFiles,
+		Charset:      "auto",
+		AutoRoute:    o.autoRoute,
+		Selectors:    o.selectors,
+		OnNoMatch:    o.onNoMatch,
+		Transforms:   []string{},
+		Plugins:      o.transforms,
+		Filters:      o.filterCommands,
+		Script:       o.script,
+		Destinations: []string{"stdout"},
+		Output: outputPlan{
+			Format:     "html",
+			Attributes: !o.removeAttributes,
+			Span:       !o.removeSpan,
+			Ruby:       string(o.ruby),
+			BidiMarks:  o.bidiMarks,
+			PDF:        o.pdf,
+		},
+	}
+
+	if o.charset != "" {
+		p.Charset = o.charset
+	}
+
+	if o.outline != "" {
+		p.Output.Format = "outline " + o.outline
+	}
+
+	if o.media != "" {
+		p.Output.Format = "media " + o.media
+	}
+
+	if o.markdown {
+		p.Output.Format = "markdown"
+		p.Output.Figures = string(o.md.Figures)
+		p.Output.Details = string(o.md.Details)
+		p.Output.Anchors = string(o.md.Anchors)
+		p.Output.Cite = string(o.md.Cite)
+	}
+
+	if o.text {
+		p.Output.Format = "text"
+		p.Output.Details = string(o.md.Details)
+		p.Output.Cite = string(o.md.Cite)
+	}
+
+	if o.downloadOGImage != "" {
+		p.Output.OGImage = "saved in " + o.downloadOGImage + ", path in the frontmatter"
+	}
+
+	if o.manifest != "" {
+		p.Output.Manifest = o.manifest
+	}
+
+	if o.favicon {
+		p.Output.Favicon = "largest icon saved in " + o.faviconDir + ", path in the frontmatter"
+	}
+
+	if o.sections != nil {
+		p.Sections = o.sections.String()
+	}
+
+	if o.timeout > 0 {
+		p.Timeout = o.timeout.String()
+	}
+
+	switch {
+	case o.isURL():
+		p.Input = inputPlan{Source: "url", Location: o.input}
+		p.Fetch = &fetchPlan{
+			Strategy:   "geckodriver",
+			Binary:     o.browserBinary(),
+			Port:       "random",
+			Bind:       o.bind,
+			Startup:    o.startupTimeout.String(),
+			Wait:       fmt.Sprintf("%ds", o.wait),
+			ConsoleLog: o.consoleLog || o.failOnJSError != nil,
+			Perf:       o.perf,
+		}
+		if o.browser == browser.Firefox {
+			driver := "geckodriver"
+			if o.geckodriver != "" {
+				driver = o.geckodriver
+			}
+			p.Fetch.Driver = strings.Join(append([]string{driver}, o.geckodriverArgs...), " ")
+		}
+		switch {
+		case o.engine == browser.EngineCDP:
+			p.Fetch.Strategy = "cdp"
+			if o.attach != "" {
+				p.Fetch.Strategy = "cdp attached to " + o.attach
+				p.Fetch.Binary = ""
+			}
+			p.Fetch.Startup = ""
+			p.Fetch.Port = "none"
+			p.Fetch.Bind = ""
+		case o.browser == browser.Chrome:
+			p.Fetch.Strategy = "chromedriver"
+			p.Fetch.Bind = ""
+		}
+		if o.webdriverURL != "" && o.engine == browser.EngineWebDriver {
+			p.Fetch.Remote = o.webdriverURL
+			p.Fetch.Driver = ""
+			p.Fetch.Port = "none"
+			p.Fetch.Bind = ""
+			p.Fetch.Startup = ""
+			if o.browser == browser.Firefox {
+				p.Fetch.Binary = ""
+			}
+		}
+		if o.failOnJSError != nil {
+			p.Fetch.FailOnJSError = o.failOnJSError.String()
+		}
+		if o.port != 0 {
+			p.Fetch.Port = fmt.Sprint(o.port)
+		}
+		if o.limits.Memory > 0 {
+			p.Fetch.MemoryLimit = fmt.Sprintf("%d bytes for the browser processes together, in a systemd scope", o.limits.Memory)
+		}
+		p.Fetch.Nice = o.limits.Nice
+		for _, header := range o.headers {
+			p.Fetch.Headers = append(p.Fetch.Headers, http.CanonicalHeaderKey(header[0]))
+		}
+		p.Fetch.UserAgent = o.userAgent
+		p.Fetch.Languages = o.languages
+		if o.viewport != nil {
+			p.Fetch.Viewport = o.viewport.String()
+			if o.device != "" {
+				p.Fetch.Viewport += " (" + o.device + ")"
+			}
+		}
+		p.Fetch.Login = o.loginScript
+		p.Fetch.Scripts = len(o.execJS)
+		p.Fetch.PDF = o.printPDF
+		p.Fetch.Click = o.click
+		if o.scrollTimes > 0 {
+			p.Fetch.Scroll = fmt.Sprintf("up to %d times, %s pause", o.scrollTimes, o.scrollPause)
+		}
+		if username, _, ok := strings.Cut(o.auth, ":"); ok {
+			p.Fetch.Auth = "basic " + username
+		}
+		if keyring.IsReference(o.auth) {
+			p.Fetch.Auth = "basic, from the keyring"
+		}
+		if o.bearer != "" {
+			p.Fetch.Auth = "bearer token"
+		}
+		if o.awsSigV4 != "" {
+			p.Fetch.Auth = "aws sigv4 " + o.awsSigV4
+		}
+		if keyring.IsReference(o.bearer) {
+			p.Fetch.Auth = "bearer token, from the keyring"
+		}
+		if keyring.IsReference(o.cookies) {
+			p.Fetch.Cookies = "load from the keyring"
+		} else if o.cookies != "" {
+			p.Fetch.Cookies = "load " + o.cookies
+			if o.saveCookies {
+				p.Fetch.Cookies += ", save after loading"
+			}
+		}
+		p.Fetch.Impersonate = o.impersonate
+		if u, err := url.Parse(o.proxy); err == nil && o.proxy != "" {
+			p.Fetch.Proxy = u.Redacted()
+		}
+		if o.tor {
+			p.Fetch.Proxy = "tor socks5://" + o.torProxy
+			if o.torControl != "" {
+				p.Fetch.Proxy += " (new circuits via " + o.torControl + ")"
+			}
+		}
+		waits := []string{}
+		selectors := browser.NewBuilder().WithSelectors(o.selectors).WithWaitFor(o.waitFor).Build().WaitSelectors()
+		if len(selectors) > 0 {
+			waits = append(waits, "selectors "+strings.Join(selectors, ", "))
+		}
+		if o.waitUntil != nil {
+			waits = append(waits, "until "+o.waitUntil.String())
+		}
+		if len(waits) > 0 {
+			p.Fetch.Wait = fmt.Sprintf("%s (at most %s each, every %s)", strings.Join(waits, ", then "), o.waitTimeout, o.poll)
+		}
+		if o.daemon != "" {
+			p.Fetch.Strategy = "daemon " + o.daemon
+			p.Fetch.Driver = ""
+			p.Fetch.Startup = ""
+			p.Fetch.Remote = ""
+			p.Fetch.Binary = ""
+			p.Fetch.Port = "none"
+			p.Fetch.Bind = ""
+			p.Fetch.MemoryLimit = ""
+			p.Fetch.Nice = 0
+		}
+		if o.noBrowser {
+			p.Fetch.Strategy = "http"
+			p.Fetch.Driver = ""
+			p.Fetch.Startup = ""
+			p.Fetch.Remote = ""
+			p.Fetch.Binary = ""
+			p.Fetch.Port = "none"
+			p.Fetch.Bind = ""
+			p.Fetch.Wait = "none"
+			p.Fetch.Scroll = ""
+			p.Fetch.Viewport = ""
+			p.Fetch.Click = nil
+			p.Fetch.ConsoleLog = false
+			p.Fetch.MemoryLimit = ""
+			p.Fetch.Nice = 0
+		}
+	case o.input == "-":
+		p.Input = inputPlan{Source: "stdin"}
+	default:
+		p.Input = inputPlan{Source: "file", Location: o.input}
+	}
+
+	if o.isHAR() {
+		p.Input.HAR = "all HTML responses"
+		if o.harURL != "" {
+			p.Input.HAR = "HTML responses matching " + o.harURL
+		}
+	}
+
+	if o.transcripts {
+		p.Transforms = append(p.Transforms, "transcripts "+o.transcriptLang)
+	}
+	if o.replaceNbsp {
+		p.Transforms = append(p.Transforms, "replace-nbsp")
+	}
+	if o.normalizeUnicode != "" {
+		p.Transforms = append(p.Transforms, "normalize-unicode "+strings.ToUpper(o.normalizeUnicode))
+	}
+	if o.asciiPunctuation {
+		p.Transforms = append(p.Transforms, "ascii-punctuation")
+	}
+	if o.normalizeDates {
+		p.Transforms = append(p.Transforms, "normalize-dates")
+	}
+	if len(o.redact) > 0 {
+		p.Transforms = append(p.Transforms, "redact "+strings.Join(o.redact, ","))
+	}
+
+	if o.out != "" {
+		p.Destinations[0] = fmt.Sprintf("%s (%s)", o.out, o.mode)
+	}
+	p.Destinations = append(p.Destinations, o.alsoWrite...)
+
+	return p
+}
+
+// explain prints the execution plan as YAML.
+func explain(w io.Writer, o options) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(newPlan(o)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,983 @@
+package cmd
+
+import (
+	"fmt"
+	stdnet "net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/text/language"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/display"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/fetch"
+	"github.com/cloudbridgeuy/puper/pkg/keyring"
+	"github.com/cloudbridgeuy/puper/pkg/markdown"
+	"github.com/cloudbridgeuy/puper/pkg/media"
+	"github.com/cloudbridgeuy/puper/pkg/outline"
+	"github.com/cloudbridgeuy/puper/pkg/output"
+	"github.com/cloudbridgeuy/puper/pkg/pdf"
+	"github.com/cloudbridgeuy/puper/pkg/pipeline"
+	"github.com/cloudbridgeuy/puper/pkg/sigv4"
+	"github.com/cloudbridgeuy/puper/pkg/text"
+)
+
+// options holds the resolved flags of a puper invocation.
+type options struct {
+	input            string
+	verbose          bool
+	explain          bool
+	selectors        []string
+	onNoMatch        []string
+	sections         *regexp.Regexp
+	outline          string
+	media            string
+	wait             int
+	waitUntil        *browser.WaitUntil
+	waitFor          []string
+	waitTimeout      time.Duration
+	poll             time.Duration
+	click            []string
+	clickDelay       time.Duration
+	scrollTimes      int
+	scrollPause      time.Duration
+	timeout          time.Duration
+	port             int
+	bind             string
+	webdriverURL     string
+	attach           string
+	startupTimeout   time.Duration
+	headers          [][2]string
+	userAgent        string
+	languages        []string
+	device           string
+	viewport         *browser.Viewport
+	execJS           []string
+	printPDF         string
+	loginScript      string
+	auth             string
+	bearer           string
+	cookies          string
+	saveCookies      bool
+	browser          string
+	engine           string
+	noBrowser        bool
+	awsSigV4         string
+	impersonate      string
+	daemon           string
+	firefoxBinary    string
+	geckodriver      string
+	geckodriverArgs  []string
+	chromeBinary     string
+	limits           browser.Limits
+	out              string
+	downloadOGImage  string
+	manifest         string
+	favicon          bool
+	faviconDir       string
+	mode             output.Mode
+	alsoWrite        []string
+	charset          string
+	removeAttributes bool
+	removeSpan       bool
+	ruby             display.RubyMode
+	bidiMarks        bool
+	autoRoute        bool
+	markdown         bool
+	text             bool
+	md               markdown.Options
+	pdf              string
+	normalizeUnicode string
+	replaceNbsp      bool
+	asciiPunctuation bool
+	normalizeDates   bool
+	redact           []string
+	transforms       []string
+	filterCommands   []string
+	transcripts      bool
+	transcriptLang   string
+	script           string
+	harURL           string
+	consoleLog       bool
+	failOnJSError    *regexp.Regexp
+	perf             bool
+	proxy            string
+	tor              bool
+	torProxy         string
+	torControl       string
+	torPassword      string
+}
+
+// readOptions reads the flags and arguments of the command.
+func readOptions(cmd *cobra.Command, args []string) (o options, err error) {
+	flags := cmd.Flags()
+
+	if err = applyConfig(flags); err != nil {
+		return o, errors.NewPuperError(err, "Invalid config file")
+	}
+
+	o.input = "-"
+	if len(args) > 0 {
+		o.input = args[0]
+	}
+
+	if o.verbose, err = flags.GetBool("verbose"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the verbose flag")
+	}
+
+	if o.explain, err = flags.GetBool("explain"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the explain flag")
+	}
+
+	if o.selectors, err = flags.GetStringSlice("selector"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the selector flag")
+	}
+
+	if o.onNoMatch, err = flags.GetStringArray("on-no-match"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the on-no-match flag")
+	}
+
+	if _, err = pipeline.ParseNoMatchPolicy(o.onNoMatch); err != nil {
+		return o, errors.NewPuperError(err, "Invalid on-no-match flag")
+	}
+
+	sections, err := flags.GetString("section-matching")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the section-matching flag")
+	}
+
+	if sections != "" {
+		if o.sections, err = regexp.Compile(sections); err != nil {
+			return o, errors.NewPuperError(err, "Invalid section-matching flag")
+		}
+	}
+
+	if o.outline, err = flags.GetString("outline"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the outline flag")
+	}
+
+	switch o.outline {
+	case "", outline.FormatText, outline.FormatMarkdown, outline.FormatJSON:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported outline format: %s", o.outline), "Invalid outline flag")
+	}
+
+	if o.media, err = flags.GetString("media"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the media flag")
+	}
+
+	switch o.media {
+	case "", media.FormatText, media.FormatMarkdown, media.FormatJSON:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported media format: %s", o.media), "Invalid media flag")
+	}
+
+	if o.media != "" && o.outline != "" {
+		return o, errors.NewPuperError(fmt.Errorf("--media and --outline can't be used together"), "Invalid media flag")
+	}
+
+	if o.wait, err = flags.GetInt("wait"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the wait flag")
+	}
+
+	waitUntil, err := flags.GetString("wait-until")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the wait-until flag")
+	}
+
+	if waitUntil != "" {
+		if o.waitUntil, err = browser.ParseWaitUntil(waitUntil); err != nil {
+			return o, errors.NewPuperError(err, "Invalid wait-until flag")
+		}
+	}
+
+	if o.waitFor, err = flags.GetStringArray("wait-for"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the wait-for flag")
+	}
+
+	for _, selector := range o.waitFor {
+		if err := browser.ValidateCSS(selector); err != nil {
+			return o, errors.NewPuperError(err, "Invalid wait-for flag")
+		}
+	}
+
+	if o.waitTimeout, err = flags.GetDuration("wait-timeout"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the wait-timeout flag")
+	}
+
+	if o.waitTimeout <= 0 {
+		return o, errors.NewPuperError(fmt.Errorf("expected a positive duration, got %s", o.waitTimeout), "Invalid wait-timeout flag")
+	}
+
+	if o.poll, err = flags.GetDuration("poll"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the poll flag")
+	}
+
+	if o.poll <= 0 {
+		return o, errors.NewPuperError(fmt.Errorf("expected a positive duration, got %s", o.poll), "Invalid poll flag")
+	}
+
+	if o.click, err = flags.GetStringArray("click"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the click flag")
+	}
+
+	for _, selector := range o.click {
+		if err := browser.ValidateCSS(selector); err != nil {
+			return o, errors.NewPuperError(err, "Invalid click flag")
+		}
+	}
+
+	if o.clickDelay, err = flags.GetDuration("click-delay"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the click-delay flag")
+	}
+
+	if o.clickDelay < 0 {
+		return o, errors.NewPuperError(fmt.Errorf("expected a positive duration, got %s", o.clickDelay), "Invalid click-delay flag")
+	}
+
+	scroll, err := flags.GetBool("scroll")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the scroll flag")
+	}
+
+	if o.scrollTimes, err = flags.GetInt("scroll-times"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the scroll-times flag")
+	}
+
+	if o.scrollTimes < 1 {
+		return o, errors.NewPuperError(fmt.Errorf("expected a positive number, got %d", o.scrollTimes), "Invalid scroll-times flag")
+	}
+
+	if !scroll {
+		o.scrollTimes = 0
+	}
+
+	if o.scrollPause, err = flags.GetDuration("scroll-pause"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the scroll-pause flag")
+	}
+
+	if o.scrollPause < 0 {
+		return o, errors.NewPuperError(fmt.Errorf("expected a positive duration, got %s", o.scrollPause), "Invalid scroll-pause flag")
+	}
+
+	if o.timeout, err = flags.GetDuration("timeout"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the timeout flag")
+	}
+
+	if o.port, err = flags.GetInt("port"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the port flag")
+	}
+
+	if o.bind, err = flags.GetString("bind"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the bind flag")
+	}
+
+	if stdnet.ParseIP(o.bind) == nil && o.bind != "localhost" {
+		return o, errors.NewPuperError(fmt.Errorf("expected an IP address, got %s", o.bind), "Invalid bind flag")
+	}
+
+	if o.webdriverURL, err = flags.GetString("webdriver-url"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the webdriver-url flag")
+	}
+
+	if o.webdriverURL != "" && !strings.HasPrefix(o.webdriverURL, "http://") && !strings.HasPrefix(o.webdriverURL, "https://") {
+		return o, errors.NewPuperError(fmt.Errorf("expected an http or https URL, got %s", o.webdriverURL), "Invalid webdriver-url flag")
+	}
+
+	if o.attach, err = flags.GetString("attach"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the attach flag")
+	}
+
+	if o.attach != "" {
+		if !strings.HasPrefix(o.attach, "ws://") && !strings.HasPrefix(o.attach, "wss://") {
+			return o, errors.NewPuperError(fmt.Errorf("expected a ws or wss URL, got %s", o.attach), "Invalid attach flag")
+		}
+		if o.webdriverURL != "" {
+			return o, errors.NewPuperError(fmt.Errorf("--attach and --webdriver-url can't be used together"), "Invalid attach flag")
+		}
+	}
+
+	if o.startupTimeout, err = flags.GetDuration("startup-timeout"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the startup-timeout flag")
+	}
+
+	if o.startupTimeout <= 0 {
+		return o, errors.NewPuperError(fmt.Errorf("expected a positive duration, got %s", o.startupTimeout), "Invalid startup-timeout flag")
+	}
+
+	headers, err := flags.GetStringArray("header")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the header flag")
+	}
+
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return o, errors.NewPuperError(fmt.Errorf("expected \"Name: value\", got %s", header), "Invalid header flag")
+		}
+		o.headers = append(o.headers, [2]string{name, strings.TrimSpace(value)})
+	}
+
+	if o.userAgent, err = flags.GetString("user-agent"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the user-agent flag")
+	}
+
+	languages, err := flags.GetStringSlice("lang")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the lang flag")
+	}
+
+	if o.languages, err = parseLanguages(languages); err != nil {
+		return o, errors.NewPuperError(err, "Invalid lang flag")
+	}
+
+	if o.device, err = flags.GetString("device"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the device flag")
+	}
+
+	if o.device != "" {
+		device, err := browser.LookupDevice(o.device)
+		if err != nil {
+			return o, errors.NewPuperError(err, "Invalid device flag")
+		}
+		o.viewport = &device.Viewport
+		if o.userAgent == "" {
+			o.userAgent = device.UserAgent
+		}
+	}
+
+	viewport, err := flags.GetString("viewport")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the viewport flag")
+	}
+
+	// The size of --viewport wins over the one of --device, which still sets
+	// the pixel ratio and the User-Agent.
+	if viewport != "" {
+		size, err := browser.ParseViewport(viewport)
+		if err != nil {
+			return o, errors.NewPuperError(err, "Invalid viewport flag")
+		}
+		if o.viewport != nil {
+			size.Scale, size.Mobile = o.viewport.Scale, o.viewport.Mobile
+		}
+		o.viewport = &size
+	}
+
+	if o.execJS, err = flags.GetStringArray("exec-js"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the exec-js flag")
+	}
+
+	execJSFiles, err := flags.GetStringArray("exec-js-file")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the exec-js-file flag")
+	}
+
+	for _, path := range execJSFiles {
+		script, err := os.ReadFile(path)
+		if err != nil {
+			return o, errors.NewPuperError(err, "Can't read the exec-js-file")
+		}
+		o.execJS = append(o.execJS, string(script))
+	}
+
+	if o.printPDF, err = flags.GetString("pdf"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the pdf flag")
+	}
+
+	if o.loginScript, err = flags.GetString("login-script"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the login-script flag")
+	}
+
+	if o.auth, err = flags.GetString("auth"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the auth flag")
+	}
+
+	if o.auth != "" && !strings.Contains(o.auth, ":") && !keyring.IsReference(o.auth) {
+		return o, errors.NewPuperError(fmt.Errorf("expected USER:PASSWORD or keyring"), "Invalid auth flag")
+	}
+
+	if o.bearer, err = flags.GetString("bearer"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the bearer flag")
+	}
+
+	if o.auth != "" && o.bearer != "" {
+		return o, errors.NewPuperError(fmt.Errorf("--auth and --bearer can't be used together"), "Invalid bearer flag")
+	}
+
+	if o.cookies, err = flags.GetString("cookies"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the cookies flag")
+	}
+
+	if o.saveCookies, err = flags.GetBool("save-cookies"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the save-cookies flag")
+	}
+
+	if o.saveCookies && o.cookies == "" {
+		return o, errors.NewPuperError(fmt.Errorf("--save-cookies needs --cookies"), "Invalid save-cookies flag")
+	}
+
+	if o.saveCookies && keyring.IsReference(o.cookies) {
+		return o, errors.NewPuperError(fmt.Errorf("--save-cookies writes a cookie file, it can't update the keyring"), "Invalid save-cookies flag")
+	}
+
+	if o.browser, err = flags.GetString("browser"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the browser flag")
+	}
+
+	switch o.browser {
+	case browser.Firefox, browser.Chrome:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported browser: %s", o.browser), "Invalid browser flag")
+	}
+
+	if o.noBrowser, err = flags.GetBool("no-browser"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the no-browser flag")
+	}
+
+	if o.daemon, err = flags.GetString("daemon"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the daemon flag")
+	}
+
+	if o.engine, err = flags.GetString("engine"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the engine flag")
+	}
+
+	switch o.engine {
+	case browser.EngineWebDriver:
+	case browser.EngineCDP:
+		o.browser = browser.Chrome
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported engine: %s", o.engine), "Invalid engine flag")
+	}
+
+	if o.attach != "" {
+		o.engine = browser.EngineCDP
+		o.browser = browser.Chrome
+	}
+
+	if o.awsSigV4, err = flags.GetString("aws-sigv4"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the aws-sigv4 flag")
+	}
+
+	if o.awsSigV4 != "" {
+		if _, _, err := sigv4.Parse(o.awsSigV4); err != nil {
+			return o, errors.NewPuperError(err, "Invalid aws-sigv4 flag")
+		}
+		if !o.noBrowser {
+			return o, errors.NewPuperError(fmt.Errorf("--aws-sigv4 signs the request of the HTTP client, it needs --no-browser"), "Invalid aws-sigv4 flag")
+		}
+		if o.auth != "" || o.bearer != "" {
+			return o, errors.NewPuperError(fmt.Errorf("--aws-sigv4 sets the Authorization header, it can't be used with --auth or --bearer"), "Invalid aws-sigv4 flag")
+		}
+	}
+
+	if o.impersonate, err = flags.GetString("impersonate"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the impersonate flag")
+	}
+
+	switch o.impersonate {
+	case "", fetch.ImpersonateChrome, fetch.ImpersonateFirefox, fetch.ImpersonateSafari:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported browser: %s, expected chrome, firefox or safari", o.impersonate), "Invalid impersonate flag")
+	}
+
+	if o.impersonate != "" && !o.noBrowser {
+		return o, errors.NewPuperError(fmt.Errorf("--impersonate changes the TLS fingerprint of the HTTP client, it needs --no-browser"), "Invalid impersonate flag")
+	}
+
+	if o.bearer != "" && o.engine == browser.EngineWebDriver && !o.noBrowser && o.daemon == "" {
+		return o, errors.NewPuperError(fmt.Errorf("browsers driven through WebDriver can't send the Authorization header, use --engine cdp or --no-browser"), "Invalid bearer flag")
+	}
+
+	if o.engine == browser.EngineWebDriver && !o.noBrowser && o.daemon == "" {
+		for _, header := range o.headers {
+			switch name := http.CanonicalHeaderKey(header[0]); {
+			case name == "User-Agent" || name == "Accept-Language":
+			case o.browser == browser.Firefox:
+				return o, errors.NewPuperError(fmt.Errorf("firefox can't send the %s header through WebDriver, use --browser chrome or --engine cdp", name), "Invalid header flag")
+			case name == "Authorization":
+				// Chromedriver can only add headers to the requests to every site.
+				return o, errors.NewPuperError(fmt.Errorf("chromedriver would send the Authorization header to every site the page loads, use --engine cdp"), "Invalid header flag")
+			}
+		}
+	}
+
+	if o.firefoxBinary, err = flags.GetString("firefox-binary"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the firefox-binary flag")
+	}
+
+	if o.geckodriver, err = flags.GetString("geckodriver-binary"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the geckodriver-binary flag")
+	}
+
+	if o.geckodriverArgs, err = flags.GetStringArray("geckodriver-arg"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the geckodriver-arg flag")
+	}
+
+	if o.chromeBinary, err = flags.GetString("chrome-binary"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the chrome-binary flag")
+	}
+
+	memoryLimit, err := flags.GetString("browser-memory-limit")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the browser-memory-limit flag")
+	}
+
+	if memoryLimit != "" {
+		if o.limits.Memory, err = browser.ParseSize(memoryLimit); err != nil {
+			return o, errors.NewPuperError(err, "Invalid browser-memory-limit flag")
+		}
+	}
+
+	if o.limits.Nice, err = flags.GetInt("browser-nice"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the browser-nice flag")
+	}
+
+	if o.limits.Nice < -20 || o.limits.Nice > 19 {
+		return o, errors.NewPuperError(fmt.Errorf("expected a value from -20 to 19, got %d", o.limits.Nice), "Invalid browser-nice flag")
+	}
+
+	if o.out, err = flags.GetString("out"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the out flag")
+	}
+
+	if o.downloadOGImage, err = flags.GetString("download-og-image"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the download-og-image flag")
+	}
+
+	if o.manifest, err = flags.GetString("manifest"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the manifest flag")
+	}
+
+	if o.favicon, err = flags.GetBool("favicon"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the favicon flag")
+	}
+
+	if o.faviconDir, err = flags.GetString("favicon-dir"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the favicon-dir flag")
+	}
+
+	mode, err := flags.GetString("mode")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the mode flag")
+	}
+
+	if o.mode, err = output.ParseMode(mode); err != nil {
+		return o, errors.NewPuperError(err, "Invalid mode flag")
+	}
+
+	if o.alsoWrite, err = flags.GetStringArray("also-write"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the also-write flag")
+	}
+
+	for _, spec := range o.alsoWrite {
+		format, path, ok := strings.Cut(spec, "=")
+		if !ok || path == "" {
+			return o, errors.NewPuperError(fmt.Errorf("expected FORMAT=PATH, got %s", spec), "Invalid also-write flag")
+		}
+
+		if format != "html" && format != "clean" {
+			return o, errors.NewPuperError(fmt.Errorf("unsupported format: %s", format), "Invalid also-write flag")
+		}
+	}
+
+	if o.charset, err = flags.GetString("charset"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the charset flag")
+	}
+
+	if o.removeAttributes, err = flags.GetBool("remove-attributes"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the remove-attributes flag")
+	}
+
+	if o.removeSpan, err = flags.GetBool("remove-span"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the remove-span flag")
+	}
+
+	ruby, err := flags.GetString("ruby")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the ruby flag")
+	}
+
+	o.ruby = display.RubyMode(ruby)
+	switch o.ruby {
+	case display.RubyKeep, display.RubyInline, display.RubyStrip:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported ruby mode: %s", ruby), "Invalid ruby flag")
+	}
+
+	if o.bidiMarks, err = flags.GetBool("bidi-marks"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the bidi-marks flag")
+	}
+
+	if o.autoRoute, err = flags.GetBool("auto-route"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the auto-route flag")
+	}
+
+	if o.markdown, err = flags.GetBool("markdown"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the markdown flag")
+	}
+
+	if o.markdown && (o.outline != "" || o.media != "") {
+		return o, errors.NewPuperError(fmt.Errorf("--markdown can't be used with --outline or --media, they have a markdown format of their own"), "Invalid markdown flag")
+	}
+
+	if o.text, err = flags.GetBool("text"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the text flag")
+	}
+
+	if o.text && (o.markdown || o.outline != "" || o.media != "") {
+		return o, errors.NewPuperError(fmt.Errorf("--text can't be used with --markdown, --outline or --media"), "Invalid text flag")
+	}
+
+	figures, err := flags.GetString("md-figures")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the md-figures flag")
+	}
+
+	o.md.Figures = markdown.FigureMode(figures)
+	switch o.md.Figures {
+	case markdown.FigureCaption, markdown.FigureAdmonition:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported figure mode: %s", figures), "Invalid md-figures flag")
+	}
+
+	details, err := flags.GetString("md-details")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the md-details flag")
+	}
+
+	o.md.Details = markdown.DetailsMode(details)
+	switch o.md.Details {
+	case markdown.DetailsExpand, markdown.DetailsKeep, markdown.DetailsDrop:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported details mode: %s", details), "Invalid md-details flag")
+	}
+
+	anchors, err := flags.GetString("md-anchors")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the md-anchors flag")
+	}
+
+	o.md.Anchors = markdown.AnchorMode(anchors)
+	switch o.md.Anchors {
+	case markdown.AnchorNone, markdown.AnchorPandoc, markdown.AnchorGFM:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported anchor mode: %s", anchors), "Invalid md-anchors flag")
+	}
+
+	cite, err := flags.GetString("cite")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the cite flag")
+	}
+
+	o.md.Cite = markdown.CiteMode(cite)
+	switch o.md.Cite {
+	case markdown.CiteNone, markdown.CiteDocument, markdown.CiteSection:
+	default:
+		return o, errors.NewPuperError(fmt.Errorf("unsupported cite mode: %s", cite), "Invalid cite flag")
+	}
+
+	if o.md.Cite != markdown.CiteNone && !o.markdown && !o.text {
+		return o, errors.NewPuperError(fmt.Errorf("--cite needs --markdown or --text, the HTML output has no room for a source line"), "Invalid cite flag")
+	}
+
+	layout, err := flags.GetBool("pdf-layout")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the pdf-layout flag")
+	}
+
+	switch {
+	case o.markdown && layout:
+		return o, errors.NewPuperError(fmt.Errorf("--markdown and --pdf-layout can't be used together"), "Invalid pdf flags")
+	case o.markdown:
+		o.pdf = pdf.FormatMarkdown
+	case layout:
+		o.pdf = pdf.FormatLayout
+	default:
+		o.pdf = pdf.FormatText
+	}
+
+	if o.normalizeUnicode, err = flags.GetString("normalize-unicode"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the normalize-unicode flag")
+	}
+
+	if o.replaceNbsp, err = flags.GetBool("replace-nbsp"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the replace-nbsp flag")
+	}
+
+	if o.asciiPunctuation, err = flags.GetBool("ascii-punctuation"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the ascii-punctuation flag")
+	}
+
+	if o.normalizeDates, err = flags.GetBool("normalize-dates"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the normalize-dates flag")
+	}
+
+	if o.redact, err = flags.GetStringSlice("redact"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the redact flag")
+	}
+
+	if o.transforms, err = flags.GetStringArray("transform"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the transform flag")
+	}
+
+	if o.filterCommands, err = flags.GetStringArray("filter-cmd"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the filter-cmd flag")
+	}
+
+	if o.transcripts, err = flags.GetBool("transcripts"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the transcripts flag")
+	}
+
+	if o.transcriptLang, err = flags.GetString("transcript-lang"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the transcript-lang flag")
+	}
+
+	if o.transcriptLang == "" {
+		return o, errors.NewPuperError(fmt.Errorf("expected a language code like en or pt-BR"), "Invalid transcript-lang flag")
+	}
+
+	if o.script, err = flags.GetString("script"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the script flag")
+	}
+
+	if o.harURL, err = flags.GetString("har-url"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the har-url flag")
+	}
+
+	if o.consoleLog, err = flags.GetBool("console-log"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the console-log flag")
+	}
+
+	failOnJSError, err := flags.GetString("fail-on-js-error")
+	if err != nil {
+		return o, errors.NewPuperError(err, "Can't get the fail-on-js-error flag")
+	}
+
+	if failOnJSError != "" {
+		if o.failOnJSError, err = regexp.Compile(failOnJSError); err != nil {
+			return o, errors.NewPuperError(err, "Invalid fail-on-js-error flag")
+		}
+		// Without a browser no script runs, so the check could never fail.
+		if o.noBrowser {
+			return o, errors.NewPuperError(fmt.Errorf("--fail-on-js-error needs a browser to run the scripts of the page, it can't be used with --no-browser"), "Invalid fail-on-js-error flag")
+		}
+	}
+
+	if o.perf, err = flags.GetBool("perf"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the perf flag")
+	}
+
+	if o.tor, err = flags.GetBool("tor"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the tor flag")
+	}
+
+	if o.proxy, err = flags.GetString("proxy"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the proxy flag")
+	}
+
+	if o.proxy != "" {
+		u, err := url.Parse(o.proxy)
+		if err != nil {
+			return o, errors.NewPuperError(err, "Invalid proxy flag")
+		}
+
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h", "socks4":
+		default:
+			return o, errors.NewPuperError(fmt.Errorf("unsupported proxy scheme: %s", u.Scheme), "Invalid proxy flag")
+		}
+
+		if o.tor {
+			return o, errors.NewPuperError(fmt.Errorf("--proxy and --tor can't be used together"), "Invalid proxy flag")
+		}
+	}
+
+	// An attached browser has its own network settings, the page would load
+	// outside the proxy.
+	if o.attach != "" && (o.proxy != "" || o.tor) {
+		return o, errors.NewPuperError(fmt.Errorf("an attached browser can't be routed through --proxy or --tor"), "Invalid attach flag")
+	}
+
+	if o.torProxy, err = flags.GetString("tor-proxy"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the tor-proxy flag")
+	}
+
+	if o.torControl, err = flags.GetString("tor-control"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the tor-control flag")
+	}
+
+	if o.torPassword, err = flags.GetString("tor-control-password"); err != nil {
+		return o, errors.NewPuperError(err, "Can't get the tor-control-password flag")
+	}
+
+	if o.daemon != "" {
+		if flag := o.daemonConflict(); flag != "" {
+			return o, errors.NewPuperError(fmt.Errorf("the daemon browser keeps the settings it was started with, %s can't be used with --daemon", flag), "Invalid daemon flag")
+		}
+	}
+
+	return o, nil
+}
+
+// daemonConflict returns the first flag set that changes the browser
+// instead of the page, which the daemon can't apply to its running Firefox.
+// Ignoring them would load the page without the proxy or the headers the
+// user asked for.
+func (o options) daemonConflict() string {
+	switch {
+	case o.proxy != "":
+		return "--proxy"
+	case o.tor:
+		return "--tor"
+	case len(o.headers) > 0:
+		return "--header"
+	case o.userAgent != "":
+		return "--user-agent"
+	case len(o.languages) > 0:
+		return "--lang"
+	case o.device != "":
+		return "--device"
+	case o.bearer != "":
+		return "--bearer"
+	case o.engine != browser.EngineWebDriver:
+		return "--engine"
+	case o.browser != browser.Firefox:
+		return "--browser"
+	case o.attach != "":
+		return "--attach"
+	case o.webdriverURL != "":
+		return "--webdriver-url"
+	case o.noBrowser:
+		return "--no-browser"
+	case !o.limits.IsZero():
+		return "--browser-memory-limit and --browser-nice"
+	}
+	return ""
+}
+
+// parseLanguages validates the language tags, like `es-UY` and `en`, and
+// returns them in their canonical form.
+func parseLanguages(values []string) ([]string, error) {
+	languages := []string{}
+	for _, value := range values {
+		tag, err := language.Parse(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid language %q: %w", value, err)
+		}
+		languages = append(languages, tag.String())
+	}
+	return languages, nil
+}
+
+// isURL reports whether the input has to be fetched from the web.
+func (o options) isURL() bool {
+	return strings.HasPrefix(o.input, "http://") || strings.HasPrefix(o.input, "https://")
+}
+
+// remoteURL returns the URL of the browser or WebDriver server to use
+// instead of starting one, if any.
+func (o options) remoteURL() string {
+	if o.attach != "" {
+		return o.attach
+	}
+	return o.webdriverURL
+}
+
+// browserBinary returns the binary of the selected browser.
+func (o options) browserBinary() string {
+	if o.browser == browser.Chrome {
+		return o.chromeBinary
+	}
+	return o.firefoxBinary
+}
+
+// isHAR reports whether the input is an HTTP Archive.
+func (o options) isHAR() bool {
+	return o.harURL != "" || (!o.isURL() && strings.HasSuffix(strings.ToLower(o.input), ".har"))
+}
+
+// httpClient returns the HTTP client for the requests made besides loading
+// the page, like downloading transcripts, going through the same proxy.
+// secret returns the value of a credential flag, read from the keyring
+// when it references it.
+func (o options) secret(value, kind string) (string, error) {
+	if !keyring.IsReference(value) {
+		return value, nil
+	}
+	host, err := keyring.Host(value, o.input)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Get(host, kind)
+}
+
+func (o options) httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy := o.proxy
+	if o.tor {
+		proxy = "socks5://" + o.torProxy
+	}
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// textFilters builds the text filters requested through the flags, in the
+// order they get applied.
+func (o options) textFilters() ([]text.Filter, error) {
+	filters := []text.Filter{}
+
+	if o.replaceNbsp {
+		filters = append(filters, text.ReplaceNbsp)
+	}
+
+	if o.normalizeUnicode != "" {
+		normalize, err := text.Normalize(o.normalizeUnicode)
+		if err != nil {
+			return nil, errors.NewPuperError(err, "Invalid normalize-unicode flag")
+		}
+		filters = append(filters, normalize)
+	}
+
+	if o.asciiPunctuation {
+		filters = append(filters, text.AsciiPunctuation)
+	}
+
+	if len(o.redact) > 0 {
+		redact, err := o.redactFilter()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, redact)
+	}
+
+	return filters, nil
+}
+
+// redactFilter builds the filter of the --redact patterns, which also
+// applies to the printed attribute values, like the addresses of mailto:
+// links.
+func (o options) redactFilter() (text.Filter, error) {
+	redact, err := text.Redact(o.redact, viper.GetStringMapString("redact-patterns"))
+	if err != nil {
+		return nil, errors.NewPuperError(err, "Invalid redact flag")
+	}
+	return redact, nil
+}
@@ -22,28 +22,61 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"bytes"
+	"context"
 	"io"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/cdp"
+	"github.com/cloudbridgeuy/puper/pkg/chromedriver"
+	"github.com/cloudbridgeuy/puper/pkg/config"
+	"github.com/cloudbridgeuy/puper/pkg/daemon"
 	"github.com/cloudbridgeuy/puper/pkg/display"
 	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/favicon"
+	"github.com/cloudbridgeuy/puper/pkg/fetch"
 	"github.com/cloudbridgeuy/puper/pkg/geckodriver"
-	"github.com/cloudbridgeuy/puper/pkg/html"
+	"github.com/cloudbridgeuy/puper/pkg/har"
+	"github.com/cloudbridgeuy/puper/pkg/keyring"
 	"github.com/cloudbridgeuy/puper/pkg/logger"
-	"github.com/cloudbridgeuy/puper/pkg/net"
+	"github.com/cloudbridgeuy/puper/pkg/manifest"
+	"github.com/cloudbridgeuy/puper/pkg/media"
+	"github.com/cloudbridgeuy/puper/pkg/ogimage"
+	"github.com/cloudbridgeuy/puper/pkg/outline"
+	"github.com/cloudbridgeuy/puper/pkg/output"
+	"github.com/cloudbridgeuy/puper/pkg/pdf"
+	"github.com/cloudbridgeuy/puper/pkg/pipeline"
+	"github.com/cloudbridgeuy/puper/pkg/route"
+	"github.com/cloudbridgeuy/puper/pkg/sigv4"
+	"github.com/cloudbridgeuy/puper/pkg/text"
+	"github.com/cloudbridgeuy/puper/pkg/tor"
+	"github.com/cloudbridgeuy/puper/pkg/transcript"
+	"github.com/cloudbridgeuy/puper/pkg/transform"
 )
 
-var cfgFile string
+var (
+	cfgFile        string
+	noConfig       bool
+	logDestination string
+	// configFiles lists the config files that were loaded, from the lowest to
+	// the highest precedence.
+	configFiles []string
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "puper [STDIN/FILE/URL]",
-	Short: "Manipulate HTML read from a file, stdin, or an url",
+	Use:   "puper [STDIN/FILE/URL/HAR]",
+	Short: "Manipulate HTML read from a file, stdin, an url, or a HAR file",
 	Long: `
 Puper
 -----
@@ -58,128 +91,541 @@ URL, allowing you to render pages that require client-side JavaScript
 rendering. Each call will spawn a new instance of both resources, listening
 on a random open port of your machine (by default), so you can run multiple
 instances of 'puper' at the same time without issues (other than your
-hardware's resources).`,
+hardware's resources).
+
+Exits with a non-zero status when the run fails, like when the selectors
+match nothing with --on-no-match error.`,
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		verbose, err := cmd.Flags().GetBool("verbose")
+		if err := run(cmd, args); err != nil {
+			errors.HandleError(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// run runs the root command. Its error fails the run with a non-zero exit
+// status, once the deferred cleanups are done.
+func run(cmd *cobra.Command, args []string) error {
+	o, err := readOptions(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if o.verbose {
+		logger.Verbose()
+	}
+
+	if o.explain {
+		if err := explain(cmd.OutOrStdout(), o); err != nil {
+			return errors.NewPuperError(err, "Can't print the execution plan")
+		}
+		return nil
+	}
+
+	if o.out != "" && o.mode == output.ModeSkip && output.Exists(o.out) {
+		logger.Logger.Info("Skipping, the output file already exists", "path", o.out)
+		return nil
+	}
+
+	onNoMatch, _ := pipeline.ParseNoMatchPolicy(o.onNoMatch)
+
+	ctx := cmd.Context()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	filters, err := o.textFilters()
+	if err != nil {
+		return err
+	}
+	// filter runs the text filters over the outputs printed in one go.
+	filter := text.Chain(filters)
+
+	client, err := o.httpClient()
+	if err != nil {
+		return errors.NewPuperError(err, "Can't create the HTTP client")
+	}
+
+	transforms := []transform.Transform{}
+	if o.transcripts {
+		transforms = append(transforms, transcript.Transform(ctx, client, o.transcriptLang, logger.Logger))
+	}
+
+	for _, path := range o.transforms {
+		logger.Logger.Debug("Loading transform", "path", path)
+		t, err := transform.Load(path)
 		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the verbose flag")
-			return
+			return errors.NewPuperError(err, "Can't load the transform plugin")
+		}
+		transforms = append(transforms, t)
+	}
+
+	for _, command := range o.filterCommands {
+		transforms = append(transforms, transform.Command(ctx, command))
+	}
+
+	documents := []pipeline.Source{{Reader: cmd.InOrStdin(), Charset: o.charset}}
+
+	// Check if the entrypoint is a URL
+	if o.isURL() {
+		logger.Logger.Debug("Running the browser", "browser", o.browser)
+		builder := browser.NewBuilder().
+			WithUrl(o.input).
+			WithSelectors(o.selectors).
+			WithPort(o.port).
+			WithBind(o.bind).
+			WithRemoteURL(o.remoteURL()).
+			WithStartupTimeout(o.startupTimeout).
+			WithBinary(o.browserBinary()).
+			WithWait(o.wait).
+			WithWaitUntil(o.waitUntil).
+			WithWaitFor(o.waitFor).
+			WithWaitTimeout(o.waitTimeout).
+			WithPoll(o.poll).
+			WithClick(o.click, o.clickDelay).
+			WithScroll(o.scrollTimes, o.scrollPause).
+			WithConsoleLog(o.consoleLog).
+			WithFailOnError(o.failOnJSError).
+			WithPerf(o.perf).
+			WithLimits(o.limits)
+
+		if o.browser == browser.Firefox {
+			builder.WithDriver(o.geckodriver, o.geckodriverArgs)
 		}
 
-		if verbose {
-			logger.Verbose()
+		for _, header := range o.headers {
+			builder.WithHeader(header[0], header[1])
 		}
 
-		var inputReader io.Reader = cmd.InOrStdin()
+		if o.userAgent != "" {
+			builder.WithUserAgent(o.userAgent)
+		}
 
-		if len(args) == 0 {
-			args = []string{"-"}
+		if len(o.languages) > 0 {
+			builder.WithLanguages(o.languages)
 		}
 
-		selectors, err := cmd.Flags().GetStringSlice("selector")
-		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the selector flag")
-			return
+		builder.WithViewport(o.viewport)
+
+		builder.WithScripts(o.execJS).WithCharset(o.charset).WithPrintPDF(o.printPDF != "")
+
+		if o.loginScript != "" {
+			script, err := browser.ReadLoginScript(o.loginScript, config.Expand)
+			if err != nil {
+				return errors.NewPuperError(err, "Can't read the login script")
+			}
+			builder.WithLogin(script)
 		}
 
-		wait, err := cmd.Flags().GetInt("wait")
+		auth, err := o.secret(o.auth, keyring.KindAuth)
 		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the wait flag")
-			return
+			return errors.NewPuperError(err, "Can't read the auth credential from the keyring")
+		}
+
+		if username, password, ok := strings.Cut(auth, ":"); ok {
+			builder.WithBasicAuth(username, password)
 		}
 
-		port, err := cmd.Flags().GetInt("port")
+		bearer, err := o.secret(o.bearer, keyring.KindBearer)
 		if err != nil {
+			return errors.NewPuperError(err, "Can't read the bearer credential from the keyring")
+		}
+
+		if bearer != "" {
+			builder.WithBearer(bearer)
+		}
+
+		if o.impersonate != "" {
+			builder.WithImpersonate(o.impersonate)
+		}
+
+		if service, region, ok := strings.Cut(o.awsSigV4, ":"); ok {
+			credentials, err := sigv4.FromEnvironment()
 			if err != nil {
-				errors.HandleAsPuperError(err, "Can't get the port flag")
-				return
+				return errors.NewPuperError(err, "Can't get the AWS credentials")
 			}
+			builder.WithSign(sigv4.Signer{Credentials: credentials, Service: service, Region: region}.Sign)
 		}
 
-		firefoxBinary, err := cmd.Flags().GetString("firefox-binary")
-		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the firefox-binary flag")
-			return
+		if keyring.IsReference(o.cookies) {
+			header, err := o.secret(o.cookies, keyring.KindCookies)
+			if err != nil {
+				return errors.NewPuperError(err, "Can't read the cookies credential from the keyring")
+			}
+			host, _ := keyring.Host(o.cookies, o.input)
+			builder.WithCookies(keyring.Cookies(header, host))
+		} else if o.cookies != "" {
+			cookies, err := browser.ReadCookies(o.cookies)
+			if err != nil {
+				return errors.NewPuperError(err, "Can't read the cookie file")
+			}
+			builder.WithCookies(cookies).WithSaveCookies(o.saveCookies)
 		}
 
-		if port == 0 {
-			port, err = net.GetRandomUnusedPort()
-			if err != nil {
-				errors.HandleAsPuperError(err, "Can't get a random unused port from the OS")
-				return
+		if o.proxy != "" {
+			builder.WithProxy(o.proxy)
+		}
+
+		if o.tor {
+			builder.WithProxy("socks5://" + o.torProxy)
+
+			if o.torControl != "" {
+				logger.Logger.Debug("Requesting new Tor circuits", "control", o.torControl)
+				if err := tor.NewCircuit(ctx, o.torControl, o.torPassword); err != nil {
+					return errors.NewPuperError(err, "Can't get new Tor circuits")
+				}
 			}
 		}
 
-		// Check if the entrypoint is a URL
-		if strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") {
-			logger.Logger.Debugf("Running geckodriver")
-			g := geckodriver.NewGeckodriverBuilder().
-				WithUrl(args[0]).
-				WithSelectors(selectors).
-				WithPort(port).
-				WithBinary(firefoxBinary).
-				WithDefaultLogger().
-				WithWait(wait).
-				Build()
+		g := newDriver(o, builder.Build())
+		fetchedAt := time.Now()
+		err = g.Run(ctx)
 
-			err = g.Run()
-			if err != nil {
-				errors.HandleAsPuperError(err, "Geckodriver failed to fetch the page source")
-				return
+		for _, message := range g.GetConsoleMessages() {
+			if message.IsError() || message.Level == "warning" || message.Level == "warn" {
+				logger.Logger.Warn("Browser console", "level", message.Level, "message", message.Text)
+			} else {
+				logger.Logger.Info("Browser console", "level", message.Level, "message", message.Text)
 			}
+		}
+
+		if metrics := g.GetPerfMetrics(); metrics != nil {
+			logger.Logger.Info("Page performance",
+				"ttfb", metrics.TTFB,
+				"dom-content-loaded", metrics.DOMContentLoaded,
+				"load", metrics.Load,
+				"transfer-size", metrics.TransferSize)
+		}
+
+		if err != nil {
+			return errors.NewPuperError(err, "Can't fetch the page source").WithStage(errors.StageFetch).WithURL(o.input)
+		}
 
-			inputReader = strings.NewReader(g.GetSource())
-		} else if args[0] != "-" {
-			file, err := os.Open(args[0])
+		if o.printPDF != "" {
+			logger.Logger.Debug("Saving the printed page", "path", o.printPDF, "bytes", len(g.GetPDF()))
+			file, err := output.Open(o.printPDF, output.ModeOverwrite)
+			if err == nil {
+				defer file.Discard()
+				if _, err = file.Write(g.GetPDF()); err == nil {
+					err = file.Commit()
+				}
+			}
 			if err != nil {
-				errors.HandleAsPuperError(err, "Can't open file")
-				return
+				return errors.NewPuperError(err, "Can't write the PDF file").WithStage(errors.StageOutput).WithURL(o.input)
+			}
+		}
+
+		if o.saveCookies {
+			logger.Logger.Debug("Saving cookies", "path", o.cookies, "cookies", len(g.GetCookies()))
+			if err := browser.WriteCookies(o.cookies, g.GetCookies()); err != nil {
+				return errors.NewPuperError(err, "Can't write the cookie file")
 			}
-			inputReader = file
 		}
 
-		charset, err := cmd.Flags().GetString("charset")
+		// The drivers decode the page, so its source is always UTF-8.
+		documents[0].Reader = strings.NewReader(g.GetSource())
+		documents[0].Charset = "utf-8"
+		documents[0].URL = g.GetURL()
+		documents[0].FetchedAt = fetchedAt
+		documents[0].ContentType = g.GetContentType()
+	} else if o.input != "-" {
+		file, err := os.Open(o.input)
 		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the charset flag")
-			return
+			return errors.NewPuperError(err, "Can't open file").WithStage(errors.StageFetch)
 		}
+		documents[0].Reader = file
+	}
 
-		root, err := html.ParseHTML(inputReader, charset)
+	if o.isHAR() {
+		documents, err = readHAR(documents[0].Reader, o)
 		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the html document")
-			return
+			return err
 		}
+	}
 
-		selectedNodes, err := html.Get(root, selectors)
+	outputs := []io.Writer{cmd.OutOrStdout()}
+	files := []*output.File{}
+	if o.out != "" {
+		file, err := output.Open(o.out, o.mode)
 		if err != nil {
-			errors.HandleAsPuperError(err, "Can't run selectors on root")
-			return
+			return errors.NewPuperError(err, "Can't create the output file").WithStage(errors.StageOutput)
 		}
+		defer file.Discard()
+
+		outputs[0] = file
+		files = append(files, file)
+	}
 
-		removeAttributes, err := cmd.Flags().GetBool("remove-attributes")
+	sources := []io.Writer{}
+	for _, spec := range o.alsoWrite {
+		format, path, _ := strings.Cut(spec, "=")
+
+		file, err := output.Open(path, output.ModeOverwrite)
 		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the remove-attributes flag")
-			return
+			return errors.NewPuperError(err, "Can't create the also-write file").WithStage(errors.StageOutput)
+		}
+		defer file.Discard()
+		files = append(files, file)
+
+		if format == "html" {
+			sources = append(sources, file)
+		} else {
+			outputs = append(outputs, file)
 		}
-		removeSpan, err := cmd.Flags().GetBool("remove-span")
+	}
+
+	// The digest describes each document in the manifest.
+	writer := output.NewDigest(io.MultiWriter(outputs...))
+	entries := []manifest.Entry{}
+	record := func(doc pipeline.Source, title string, words int) {
+		entries = append(entries, manifest.Entry{
+			URL:         doc.URL,
+			Title:       title,
+			Path:        o.out,
+			Hash:        writer.Sum(),
+			Words:       words,
+			FetchedAt:   manifest.Timestamp(doc.FetchedAt),
+			ProcessedAt: manifest.Timestamp(time.Now()),
+		})
+	}
+
+	displayBuilder := display.NewDisplayBuilder().
+		WithWriter(writer).
+		WithAttributes(!o.removeAttributes).
+		WithSpan(!o.removeSpan).
+		WithRuby(o.ruby).
+		WithBidiMarks(o.bidiMarks)
+
+	for _, filter := range filters {
+		displayBuilder.WithTextFilter(filter)
+	}
+
+	if len(o.redact) > 0 {
+		redact, err := o.redactFilter()
 		if err != nil {
-			errors.HandleAsPuperError(err, "Can't get the remove-span flag")
-			return
+			return err
 		}
+		displayBuilder.WithAttributeFilter(redact)
+	}
 
-		display.NewDisplayBuilder().
-			WithAttributes(!removeAttributes).
-			WithSpan(!removeSpan).
-			Build().
-			Print(selectedNodes)
-	},
+	d := displayBuilder.Build()
+
+	for _, doc := range documents {
+		writer.Reset()
+		reader := doc.Reader
+		for _, source := range sources {
+			reader = io.TeeReader(reader, source)
+		}
+
+		doc.Reader = reader
+		result, err := pipeline.Process(ctx, doc, pipeline.Options{
+			Route:          o.autoRoute,
+			PDF:            o.pdf,
+			Selectors:      o.selectors,
+			OnNoMatch:      onNoMatch,
+			Sections:       o.sections,
+			NormalizeDates: o.normalizeDates,
+			Transforms:     transforms,
+			Script:         o.script,
+			Markdown:       o.md,
+		})
+		if err != nil {
+			return err
+		}
+		for _, warning := range result.Warnings {
+			logger.Logger.Warn(warning, "url", result.FinalURL)
+		}
+		logger.Logger.Debug("Processed document", "url", result.FinalURL, "kind", result.Kind, "title", result.Title, "nodes", result.Stats.Nodes, "bytes", result.Stats.Bytes, "duration", result.Stats.Duration)
+
+		if result.Kind != route.HTML {
+			content := result.Text
+			if result.Kind == route.PDF && o.pdf == pdf.FormatMarkdown {
+				content = result.Markdown
+			}
+			if _, err := io.WriteString(writer, filter(content)); err != nil {
+				return errors.NewPuperError(err, "Can't print the "+result.Kind+" document").WithStage(errors.StageOutput).WithURL(result.FinalURL)
+			}
+			record(doc, "", len(strings.Fields(result.Text)))
+			continue
+		}
+
+		if o.downloadOGImage != "" || o.favicon {
+			frontmatter := output.Frontmatter{Title: filter(result.Title), URL: result.FinalURL}
+
+			if o.downloadOGImage != "" {
+				if imageURL := ogimage.URL(result.Metadata, result.FinalURL); imageURL == "" {
+					logger.Logger.Warn("The page has no og:image", "url", result.FinalURL)
+				} else if frontmatter.OGImage, err = ogimage.Download(ctx, client, imageURL, o.downloadOGImage); err != nil {
+					logger.Logger.Warn("Can't download the og:image", "url", imageURL, "error", err)
+				}
+			}
+
+			if o.favicon {
+				if frontmatter.Favicon, err = favicon.Download(ctx, client, result.FinalURL, result.Links, o.faviconDir); err != nil {
+					logger.Logger.Warn("Can't download the favicon", "url", result.FinalURL, "error", err)
+				}
+			}
+
+			// JSON outputs have nowhere to put it.
+			if o.outline != outline.FormatJSON && o.media != media.FormatJSON {
+				if err := frontmatter.Write(writer); err != nil {
+					return errors.NewPuperError(err, "Can't print the frontmatter").WithStage(errors.StageOutput).WithURL(result.FinalURL)
+				}
+			}
+		}
+
+		switch {
+		case o.outline != "":
+			headings := outline.Headings(result.Nodes)
+			for i := range headings {
+				headings[i].Text = filter(headings[i].Text)
+			}
+			if err := outline.Write(writer, headings, o.outline); err != nil {
+				return errors.NewPuperError(err, "Can't print the outline").WithStage(errors.StageOutput).WithURL(result.FinalURL)
+			}
+		case o.media != "":
+			var base *url.URL
+			if result.FinalURL != "" {
+				base, _ = url.Parse(result.FinalURL)
+			}
+			elements := media.Elements(result.Nodes, base)
+			for i := range elements {
+				elements[i].Title = filter(elements[i].Title)
+				for j := range elements[i].Tracks {
+					elements[i].Tracks[j].Label = filter(elements[i].Tracks[j].Label)
+				}
+			}
+			if err := media.Write(writer, elements, o.media); err != nil {
+				return errors.NewPuperError(err, "Can't print the media").WithStage(errors.StageOutput).WithURL(result.FinalURL)
+			}
+		case o.markdown:
+			if result.Markdown != "" {
+				if _, err := io.WriteString(writer, filter(result.Markdown)+"\n"); err != nil {
+					return errors.NewPuperError(err, "Can't print the markdown").WithStage(errors.StageOutput).WithURL(result.FinalURL)
+				}
+			}
+		case o.text:
+			if result.Text != "" {
+				if _, err := io.WriteString(writer, filter(result.Text)+"\n"); err != nil {
+					return errors.NewPuperError(err, "Can't print the text").WithStage(errors.StageOutput).WithURL(result.FinalURL)
+				}
+			}
+		default:
+			if err := d.Print(ctx, result.Nodes); err != nil {
+				return errors.NewPuperError(err, "Can't print the selected nodes").WithStage(errors.StageOutput).WithURL(result.FinalURL)
+			}
+		}
+
+		// The words of the content, not of the markup around it.
+		record(doc, result.Title, len(strings.Fields(result.Text)))
+	}
+
+	written, unchanged := 0, 0
+	for _, file := range files {
+		if err := file.Commit(); err != nil {
+			return errors.NewPuperError(err, "Can't write the output file").WithStage(errors.StageOutput)
+		}
+
+		if file.Unchanged() {
+			logger.Logger.Debug("Output file unchanged", "path", file.Path())
+			unchanged++
+		} else {
+			written++
+		}
+	}
+
+	if len(files) > 0 {
+		logger.Logger.Info("Output files", "written", written, "unchanged", unchanged)
+	}
+
+	if o.manifest != "" {
+		m, err := manifest.Read(o.manifest)
+		if err != nil {
+			return errors.NewPuperError(err, "Can't read the manifest").WithStage(errors.StageOutput)
+		}
+		for _, entry := range entries {
+			m.Add(entry)
+		}
+		if err := m.Write(o.manifest); err != nil {
+			return errors.NewPuperError(err, "Can't write the manifest").WithStage(errors.StageOutput)
+		}
+		logger.Logger.Debug("Updated the manifest", "path", o.manifest, "documents", len(m.Documents))
+	}
+
+	return nil
+}
+
+// newDriver returns the driver of the browser for the engine.
+func newDriver(o options, b browser.Options) browser.Driver {
+	switch {
+	case o.noBrowser:
+		return fetch.New(b)
+	case o.daemon != "":
+		return daemon.NewClient(o.daemon, b)
+	case o.engine == browser.EngineCDP:
+		return cdp.New(b)
+	case o.browser == browser.Chrome:
+		return chromedriver.New(b)
+	default:
+		return geckodriver.New(b)
+	}
+}
+
+// readHAR returns the HTML responses of the HAR file whose URL matches the
+// har-url pattern.
+func readHAR(r io.Reader, o options) ([]pipeline.Source, error) {
+	var pattern *regexp.Regexp
+	if o.harURL != "" {
+		var err error
+		if pattern, err = regexp.Compile(o.harURL); err != nil {
+			return nil, errors.NewPuperError(err, "Invalid har-url flag")
+		}
+	}
+
+	archive, err := har.Read(r)
+	if err != nil {
+		return nil, errors.NewPuperError(err, "Can't read the HAR file").WithStage(errors.StageParse)
+	}
+
+	responses, err := archive.Documents(pattern)
+	if err != nil {
+		return nil, errors.NewPuperError(err, "Can't decode the HAR responses").WithStage(errors.StageParse)
+	}
+
+	documents := []pipeline.Source{}
+	for _, response := range responses {
+		logger.Logger.Debug("Found HTML response in HAR file", "url", response.URL)
+
+		charset := o.charset
+		if charset == "" && response.Decoded {
+			charset = "utf-8"
+		}
+		documents = append(documents, pipeline.Source{
+			Reader:    bytes.NewReader(response.Body),
+			Charset:   charset,
+			URL:       response.URL,
+			FetchedAt: response.FetchedAt,
+		})
+	}
+
+	if len(documents) == 0 {
+		logger.Logger.Warn("No HTML responses found in the HAR file", "pattern", o.harURL)
+	}
+
+	return documents, nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Interrupting the process cancels the run, which stops the browser.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
@@ -188,33 +634,141 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.puper.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.puper.yaml merged with any .puper.yaml found in the current directory and its parents)")
+	rootCmd.PersistentFlags().BoolVar(&noConfig, "no-config", false, "Don't load any config file")
+	rootCmd.PersistentFlags().StringVar(&logDestination, "log-destination", "stderr", "Where to write logs and diagnostics: stderr or a file path")
 
 	rootCmd.Flags().StringP("charset", "c", "", "Charset")
+	rootCmd.Flags().String("browser", browser.Firefox, "Browser used to render URLs: firefox or chrome")
+	rootCmd.Flags().Bool("no-browser", false, "Download URLs with a plain HTTP client instead of rendering them in a browser")
+	rootCmd.Flags().String("daemon", "", "Submit URLs to the daemon listening on this socket instead of starting a browser. See 'puper daemon start'")
+	rootCmd.Flags().Lookup("daemon").NoOptDefVal = daemon.DefaultSocket()
+	rootCmd.Flags().String("engine", browser.EngineWebDriver, "How to drive the browser: webdriver, or cdp to talk the Chrome DevTools Protocol without a driver binary. cdp always uses Chrome")
 	rootCmd.Flags().String("firefox-binary", "/Applications/Firefox.app/Contents/MacOS/firefox", "Firefox binary path")
+	rootCmd.Flags().String("geckodriver-binary", "", "Geckodriver binary path. Looked up in the PATH if empty")
+	rootCmd.Flags().StringArray("geckodriver-arg", []string{}, "Extra argument for geckodriver, like --log-level=trace. Can be repeated")
+	rootCmd.Flags().String("chrome-binary", "", "Chrome binary path. Chromedriver looks for Chrome if empty")
+	rootCmd.Flags().String("browser-memory-limit", "", "Maximum memory the browser processes use together, like 2G. Enforced with a cgroup v2 through a transient systemd scope, Linux only")
+	rootCmd.Flags().Int("browser-nice", 0, "Nice value of the browser processes, from -20 to 19. Unchanged if zero")
 	rootCmd.Flags().Int("wait", 1, "Time to wait for a page to render if an URL was provided")
-	rootCmd.Flags().Int("port", 0, "Geckodriver port. A random one will be selected if empty.")
+	rootCmd.Flags().StringArray("click", []string{}, "CSS selector of an element to click before capturing the source, like a \"Load more\" button. Can be repeated")
+	rootCmd.Flags().Duration("click-delay", 500*time.Millisecond, "Time to wait after each --click")
+	rootCmd.Flags().Bool("scroll", false, "Scroll to the bottom of the page before capturing its source, to trigger lazy loading")
+	rootCmd.Flags().Int("scroll-times", 10, "Maximum number of times to scroll with --scroll, it stops once the page stops growing")
+	rootCmd.Flags().Duration("scroll-pause", time.Second, "Time to wait for the content to load after each scroll")
+	rootCmd.Flags().StringArray("wait-for", []string{}, "CSS selector to wait for instead of the content selectors. Can be repeated")
+	rootCmd.Flags().Duration("wait-timeout", 30*time.Second, "Maximum time to wait for each selector and for the --wait-until condition")
+	rootCmd.Flags().Duration("poll", 250*time.Millisecond, "How often to check the selectors and the --wait-until condition")
+	rootCmd.Flags().String("wait-until", "", "Wait for networkidle, domcontentloaded or a JavaScript condition like js:'window.appReady === true' instead of --wait")
+	rootCmd.Flags().Duration("timeout", 0, "Abort the run if it takes longer than this, e.g. 30s. No limit if zero")
+	rootCmd.Flags().Int("port", 0, "WebDriver server port. A random one will be selected if empty.")
+	rootCmd.Flags().String("bind", "127.0.0.1", "Address geckodriver listens on")
+	rootCmd.Flags().String("attach", "", "DevTools WebSocket URL of a running Chrome or Chromium to load the page in, like ws://host:9222/devtools/browser/ID. Implies --engine=cdp")
+	rootCmd.Flags().Duration("startup-timeout", 10*time.Second, "How long to wait for geckodriver or chromedriver to be ready")
+	rootCmd.Flags().StringArray("header", []string{}, "Header added to the page requests, as \"Name: value\". Firefox driven through WebDriver only supports Accept-Language and User-Agent. Can be repeated")
+	rootCmd.Flags().String("user-agent", "", "User-Agent of the browser or the HTTP client. Overrides a User-Agent header")
+	rootCmd.Flags().StringSlice("lang", []string{}, "Languages the page is requested in, by preference, like es-UY,en. Overrides an Accept-Language header")
+	rootCmd.Flags().String("viewport", "", "Size the page is rendered at, like 1280x800")
+	rootCmd.Flags().String("device", "", "Render the page as a device would, with its viewport, pixel ratio and User-Agent: "+strings.Join(browser.DeviceNames(), ", "))
+	rootCmd.Flags().StringArray("exec-js", []string{}, "JavaScript run in the page before capturing its source, like expanding collapsed sections. A returned promise is awaited. Can be repeated")
+	rootCmd.Flags().String("pdf", "", "Print the rendered page to this PDF file with the browser, for archiving it along with the extracted content")
+	rootCmd.Flags().StringArray("exec-js-file", []string{}, "File with JavaScript run in the page after the --exec-js snippets. Can be repeated")
+	rootCmd.Flags().String("login-script", "", "YAML file with the fill, click, wait and sleep steps that log into the site before loading the page. Values can reference ${ENV} variables")
+	rootCmd.Flags().String("auth", "", "HTTP basic authentication credentials, as USER:PASSWORD, or keyring to read the ones stored with 'puper auth set'")
+	rootCmd.Flags().String("bearer", "", "Token sent in the Authorization header of the requests to the site of the page, or keyring to read the one stored with 'puper auth set'. Needs --engine cdp or --no-browser")
+	rootCmd.Flags().String("cookies", "", "JSON file with the cookies added to the browser session before loading the page, or keyring to read the Cookie header stored with 'puper auth set'")
+	rootCmd.Flags().Bool("save-cookies", false, "Write the cookies of the session back to the --cookies file after loading the page")
+	rootCmd.Flags().String("webdriver-url", "", "URL of a remote WebDriver server, like a Selenium Grid, to use instead of starting geckodriver or chromedriver")
 	rootCmd.Flags().StringSliceP("selector", "s", []string{"*"}, "CSS Selector")
+	rootCmd.Flags().StringArray("on-no-match", []string{}, "What to do when the selectors match nothing: error, empty or fallback:SELECTOR. Fallbacks are tried in order. Can be repeated")
+	rootCmd.Flags().String("section-matching", "", "Keep only the sections, a heading and its content up to the next heading of the same level, whose heading matches this regular expression")
+	rootCmd.Flags().String("outline", "", "Print only the headings of the selected content, with their levels and anchors: text, markdown or json")
+	rootCmd.Flags().Lookup("outline").NoOptDefVal = outline.FormatText
+	rootCmd.Flags().String("media", "", "Print only the <video> and <audio> elements of the selected content, with their sources, posters, durations and caption tracks: json, markdown or text")
+	rootCmd.Flags().Lookup("media").NoOptDefVal = media.FormatJSON
 	rootCmd.Flags().Bool("remove-attributes", false, "Remove attributes")
 	rootCmd.Flags().Bool("remove-span", false, "Remove span")
+	rootCmd.Flags().String("ruby", "keep", "How to print <ruby> annotations: keep, inline or strip")
+	rootCmd.Flags().Bool("markdown", false, "Print the selected content as markdown instead of HTML. PDF documents get headings guessed from the font sizes and a comment marking every page")
+	rootCmd.Flags().Bool("text", false, "Print the selected content as plain text instead of HTML, a paragraph per block")
+	rootCmd.Flags().String("md-figures", "caption", "How --markdown prints <figure> elements: caption, the content with its caption in italics below, or admonition, the same in a [!NOTE] quote")
+	rootCmd.Flags().String("md-details", "expand", "How --markdown and --text print <details> elements: expand, the summary in bold followed by the content, keep, the <details> and <summary> tags around the content, or drop")
+	rootCmd.Flags().String("md-anchors", "none", "How --markdown prints the ids of the headings: none, pandoc, as in '## Usage {#usage}', or gfm, as in '## <a id=\"usage\"></a>Usage'. Headings without an id get a slug of their text")
+	rootCmd.Flags().String("cite", "none", "Append a 'Source: URL (fetched DATE)' line to the --markdown and --text output: none, document, once at the end, or section, after every section with the anchor of its heading. Files and stdin have no URL to cite")
+	rootCmd.Flags().Bool("pdf-layout", false, "Print PDF documents keeping the columns and indentation of their pages")
+	rootCmd.Flags().Bool("auto-route", false, "Print JSON, XML, PDF and plain text documents according to their type instead of parsing them as HTML")
+	rootCmd.Flags().Bool("bidi-marks", false, "Wrap right-to-left text in Unicode directional isolates")
+	rootCmd.Flags().String("normalize-unicode", "", "Apply a Unicode normalization form to the text: NFC or NFKC")
+	rootCmd.Flags().Bool("replace-nbsp", false, "Replace non-breaking spaces with regular spaces")
+	rootCmd.Flags().Bool("ascii-punctuation", false, "Replace curly quotes, dashes and ellipses with ASCII characters")
+	rootCmd.Flags().Bool("normalize-dates", false, "Rewrite the dates of <time> elements and date meta tags in ISO 8601")
+	rootCmd.Flags().StringSlice("redact", []string{}, "Redact personal data from the text: email, phone, ssn or any name under 'redact-patterns' in the config file")
+	rootCmd.Flags().StringArray("transform", []string{}, "Go plugin applied to the selected nodes before printing. Can be repeated")
+	rootCmd.Flags().StringArray("filter-cmd", []string{}, "Pipe the HTML of every selected node through this shell command and parse its output back. Can be repeated")
+	rootCmd.Flags().Bool("transcripts", false, "Insert the captions of the YouTube and Vimeo videos embedded in the selected content after each of them")
+	rootCmd.Flags().String("transcript-lang", "en", "Language of the captions used with --transcripts, falling back to the first one available")
+	rootCmd.Flags().String("script", "", "Starlark script defining an extract(page) function that returns the nodes to print")
+	rootCmd.Flags().String("download-og-image", "", "Save the og:image of the page in this directory and print a frontmatter with its path, title and URL before the content")
+	rootCmd.Flags().Bool("favicon", false, "Save the largest icon of the site, from its links, its web app manifest or /favicon.ico, and print a frontmatter with its path, title and URL before the content")
+	rootCmd.Flags().String("manifest", "", "Add the printed documents to this JSON or YAML index, with their URL, title, path, hash, word count and timestamps. Entries of previous runs are kept, so it indexes a crawl made of several runs")
+	rootCmd.Flags().String("favicon-dir", ".", "Directory --favicon saves the icons in")
+	rootCmd.Flags().StringP("out", "o", "", "Write the output to this file instead of stdout")
+	rootCmd.Flags().String("mode", "overwrite", "What to do when --out already exists: overwrite, append or skip")
+	rootCmd.Flags().StringArray("also-write", []string{}, "Also write an artifact as FORMAT=PATH, where FORMAT is 'html' for the raw source or 'clean' for the printed output")
+	rootCmd.Flags().String("impersonate", "", "Request the page of --no-browser with the TLS fingerprint of chrome, firefox or safari, and its User-Agent unless one is set, for the sites blocking the Go one. Works through socks5 and http proxies")
+	rootCmd.Flags().String("aws-sigv4", "", "Sign the request of --no-browser with AWS Signature Version 4 for SERVICE:REGION, like execute-api:us-east-1, using the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables or the AWS_PROFILE profile of ~/.aws/credentials")
+	rootCmd.Flags().String("proxy", "", "URL of the proxy the browser or the HTTP client connects through: http://, https://, socks5:// or socks4://. Also read from PUPER_PROXY")
+	rootCmd.Flags().Bool("tor", false, "Route the browser through a local Tor SOCKS proxy")
+	rootCmd.Flags().String("tor-proxy", tor.DefaultProxy, "Address of the Tor SOCKS proxy used with --tor")
+	rootCmd.Flags().String("tor-control", "", "Address of the Tor control port. When set, --tor requests new circuits before every run")
+	rootCmd.Flags().String("tor-control-password", "", "Password for the Tor control port")
+	rootCmd.Flags().String("har-url", "", "Only process the HAR responses whose URL matches this regular expression. Reads the input as a HAR file")
+	rootCmd.Flags().Bool("console-log", false, "Log the messages the page writes to the browser console while it renders")
+	rootCmd.Flags().String("fail-on-js-error", "", "Fail with a non-zero exit status when the page logs a JavaScript error matching this regular expression while it loads")
+	rootCmd.Flags().Bool("perf", false, "Log the page navigation timing: TTFB, DOMContentLoaded, load and transfer size")
+	rootCmd.Flags().Bool("explain", false, "Print the resolved execution plan as YAML without running it")
 	rootCmd.Flags().Bool("verbose", false, "Verbose output")
 }
 
 func initConfig() {
-	if cfgFile != "" {
-		viper.SetConfigFile(cfgFile)
-	} else {
+	// Set the log destination before anything gets logged, so stdout only ever
+	// carries the selected document.
+	cobra.CheckErr(logger.SetDestination(logDestination))
+
+	viper.SetEnvPrefix("puper")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+
+	if noConfig {
+		return
+	}
+
+	files := []string{cfgFile}
+	if cfgFile == "" {
 		home, err := os.UserHomeDir()
 		cobra.CheckErr(err)
 
-		viper.AddConfigPath(home)
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(".puper")
+		cwd, err := os.Getwd()
+		cobra.CheckErr(err)
+
+		files = config.Discover(home, cwd)
 	}
 
-	viper.AutomaticEnv()
+	viper.SetConfigType("yaml")
+	for _, file := range files {
+		viper.SetConfigFile(file)
+
+		read := viper.MergeInConfig
+		if len(configFiles) == 0 {
+			read = viper.ReadInConfig
+		}
+
+		if err := read(); err != nil {
+			logger.Logger.Warn("Can't read config file", "path", file, "err", err)
+			continue
+		}
 
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+		logger.Logger.Info("Using config file", "path", file)
+		configFiles = append(configFiles, file)
 	}
 }
@@ -0,0 +1,545 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/tebeka/selenium"
+
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/logger"
+)
+
+// Names of the supported browsers.
+const (
+	Firefox = "firefox"
+	Chrome  = "chrome"
+)
+
+// Engines that can drive the browser.
+const (
+	// EngineWebDriver starts the WebDriver server of the browser, geckodriver
+	// or chromedriver, and drives the browser through it.
+	EngineWebDriver = "webdriver"
+	// EngineCDP starts Chrome and talks the Chrome DevTools Protocol to it.
+	EngineCDP = "cdp"
+)
+
+// Driver renders a page in a browser.
+type Driver interface {
+	// Run starts the browser, loads the page and captures its source.
+	// Cancelling the context stops the browser.
+	Run(ctx context.Context) error
+	// GetSource returns the source captured by Run.
+	GetSource() string
+	// GetURL returns the URL of the page after following redirects.
+	GetURL() string
+	// GetConsoleMessages returns the console messages captured by Run, if
+	// the console log was enabled.
+	GetConsoleMessages() []ConsoleMessage
+	// GetContentType returns the Content-Type of the page, or an empty string
+	// when it's unknown.
+	GetContentType() string
+	// GetPerfMetrics returns the navigation timing captured by Run, or nil if
+	// it wasn't requested or available.
+	GetPerfMetrics() *PerfMetrics
+	// GetCookies returns the cookies of the session captured by Run, if
+	// SaveCookies was set.
+	GetCookies() []Cookie
+	// GetPDF returns the page printed by Run, if PrintPDF was set.
+	GetPDF() []byte
+}
+
+// Options are the settings shared by every driver.
+type Options struct {
+	Logger *log.Logger
+	URL    string
+	Binary string
+	// Driver is the path of the WebDriver server binary, looked up in the
+	// PATH when empty, and DriverArgs are extra arguments passed to it.
+	Driver     string
+	DriverArgs []string
+	// Port is the port of the WebDriver server. A random one is picked when
+	// zero.
+	Port int
+	// Bind is the address the WebDriver server listens on.
+	Bind string
+	// RemoteURL is the URL of a WebDriver server, like a Selenium Grid, or
+	// the DevTools WebSocket of a running browser for the cdp engine, to use
+	// instead of starting one.
+	RemoteURL string
+	// StartupTimeout is how long to wait for the WebDriver server to be
+	// ready.
+	StartupTimeout time.Duration
+	Selectors      []string
+	Wait           int
+	// WaitUntil replaces the wait when set.
+	WaitUntil *WaitUntil
+	// WaitFor are the selectors waited for instead of the content ones.
+	WaitFor []string
+	// WaitTimeout bounds the wait for each selector and for WaitUntil.
+	WaitTimeout time.Duration
+	// Poll is how often the selectors and WaitUntil are checked.
+	Poll time.Duration
+	// Click are the selectors of the elements clicked, in order, once the
+	// page is loaded, pausing ClickDelay after each click.
+	Click      []string
+	ClickDelay time.Duration
+	// ScrollTimes is how many times the page is scrolled to the bottom to
+	// trigger lazy loading, pausing ScrollPause each time.
+	ScrollTimes int
+	ScrollPause time.Duration
+	// Charset overrides the charset of the page when it's downloaded without
+	// a browser, which otherwise comes from the response.
+	Charset string
+	// Proxy is the URL of the proxy the browser connects through, like
+	// `socks5://127.0.0.1:9050`.
+	Proxy string
+	// Headers are added to the requests of the page. Browsers driven through
+	// WebDriver only support Accept-Language and User-Agent.
+	Headers http.Header
+	// Username and Password are the HTTP basic authentication credentials.
+	Username string
+	Password string
+	// Sign signs the request of the page downloaded without a browser, like
+	// with AWS SigV4.
+	Sign func(*http.Request) error
+	// Impersonate is the browser whose TLS fingerprint the page downloaded
+	// without a browser is requested with: chrome, firefox or safari.
+	Impersonate string
+	// Scripts are run in the page, in order, before capturing its source.
+	// They are function bodies and a returned promise is awaited.
+	Scripts []string
+	// Login is run before loading the page.
+	Login *LoginScript
+	// Cookies are added to the session before loading the page.
+	Cookies []Cookie
+	// SaveCookies captures the cookies of the session after loading the page.
+	SaveCookies bool
+	// Viewport is the size the page is rendered at. The browser keeps its
+	// default size when nil.
+	Viewport *Viewport
+	// PrintPDF prints the rendered page to a PDF document.
+	PrintPDF   bool
+	ConsoleLog bool
+	FailOn     *regexp.Regexp
+	Perf       bool
+	Limits     Limits
+}
+
+// Builder collects the Options of a driver.
+type Builder struct {
+	inner Options
+}
+
+// NewBuilder returns a builder using the default logger.
+func NewBuilder() *Builder {
+	return &Builder{
+		inner: Options{
+			Logger:         logger.Logger,
+			Bind:           "127.0.0.1",
+			StartupTimeout: 10 * time.Second,
+			WaitTimeout:    30 * time.Second,
+			Poll:           250 * time.Millisecond,
+		},
+	}
+}
+
+// WithLogger sets the logger used by the driver.
+func (b *Builder) WithLogger(l *log.Logger) *Builder {
+	b.inner.Logger = l
+	return b
+}
+
+// WithBinary sets the path of the browser binary. The WebDriver server looks
+// for the browser itself when it is empty.
+func (b *Builder) WithBinary(binary string) *Builder {
+	b.inner.Binary = binary
+	return b
+}
+
+// WithDriver sets the path of the WebDriver server binary and extra
+// arguments for it.
+func (b *Builder) WithDriver(binary string, args []string) *Builder {
+	b.inner.Driver = binary
+	b.inner.DriverArgs = args
+	return b
+}
+
+// WithPort sets the port of the WebDriver server.
+func (b *Builder) WithPort(port int) *Builder {
+	b.inner.Port = port
+	return b
+}
+
+// WithBind sets the address the WebDriver server listens on.
+func (b *Builder) WithBind(address string) *Builder {
+	b.inner.Bind = address
+	return b
+}
+
+// WithRemoteURL uses the WebDriver server at the URL instead of starting
+// one.
+func (b *Builder) WithRemoteURL(url string) *Builder {
+	b.inner.RemoteURL = url
+	return b
+}
+
+// WithStartupTimeout sets how long to wait for the WebDriver server to be
+// ready.
+func (b *Builder) WithStartupTimeout(timeout time.Duration) *Builder {
+	b.inner.StartupTimeout = timeout
+	return b
+}
+
+// WithWaitUntil waits for the condition instead of sleeping once the page
+// is loaded.
+func (b *Builder) WithWaitUntil(until *WaitUntil) *Builder {
+	b.inner.WaitUntil = until
+	return b
+}
+
+// WithWaitFor waits for the selectors instead of the content ones.
+func (b *Builder) WithWaitFor(selectors []string) *Builder {
+	b.inner.WaitFor = selectors
+	return b
+}
+
+// WithWaitTimeout bounds the wait for each selector and condition.
+func (b *Builder) WithWaitTimeout(timeout time.Duration) *Builder {
+	b.inner.WaitTimeout = timeout
+	return b
+}
+
+// WithPoll sets how often the selectors and the condition are checked.
+func (b *Builder) WithPoll(poll time.Duration) *Builder {
+	b.inner.Poll = poll
+	return b
+}
+
+// WithClick clicks the elements matching the selectors, pausing between
+// them, before capturing the source.
+func (b *Builder) WithClick(selectors []string, delay time.Duration) *Builder {
+	b.inner.Click = selectors
+	b.inner.ClickDelay = delay
+	return b
+}
+
+// WithScroll scrolls to the bottom of the page the number of times, pausing
+// between them, before capturing its source.
+func (b *Builder) WithScroll(times int, pause time.Duration) *Builder {
+	b.inner.ScrollTimes = times
+	b.inner.ScrollPause = pause
+	return b
+}
+
+// WithSelectors sets the selectors. They are waited for before the source
+// gets captured, unless WithWaitFor sets others.
+func (b *Builder) WithSelectors(selectors []string) *Builder {
+	b.inner.Selectors = selectors
+	return b
+}
+
+// WithUrl sets the URL of the page.
+func (b *Builder) WithUrl(url string) *Builder {
+	b.inner.URL = url
+	return b
+}
+
+// WithWait sets the seconds to wait for the page to render when there is no
+// selector to wait for.
+func (b *Builder) WithWait(wait int) *Builder {
+	b.inner.Wait = wait
+	return b
+}
+
+// WithCharset overrides the charset of the page downloaded without a
+// browser.
+func (b *Builder) WithCharset(charset string) *Builder {
+	b.inner.Charset = charset
+	return b
+}
+
+// WithSign signs the request of the page downloaded without a browser.
+func (b *Builder) WithSign(sign func(*http.Request) error) *Builder {
+	b.inner.Sign = sign
+	return b
+}
+
+// WithImpersonate requests the page downloaded without a browser with the
+// TLS fingerprint of the browser.
+func (b *Builder) WithImpersonate(browser string) *Builder {
+	b.inner.Impersonate = browser
+	return b
+}
+
+// WithProxy routes the browser traffic through the proxy URL.
+func (b *Builder) WithProxy(proxy string) *Builder {
+	b.inner.Proxy = proxy
+	return b
+}
+
+// WithHeader adds a header to the requests of the page.
+func (b *Builder) WithHeader(name, value string) *Builder {
+	if b.inner.Headers == nil {
+		b.inner.Headers = http.Header{}
+	}
+	b.inner.Headers.Add(name, value)
+	return b
+}
+
+// WithUserAgent overrides the User-Agent of the browser.
+func (b *Builder) WithUserAgent(userAgent string) *Builder {
+	if b.inner.Headers == nil {
+		b.inner.Headers = http.Header{}
+	}
+	b.inner.Headers.Set("User-Agent", userAgent)
+	return b
+}
+
+// WithLanguages overrides the Accept-Language of the browser with the
+// languages, by preference, like `es-UY` then `en`.
+func (b *Builder) WithLanguages(languages []string) *Builder {
+	if b.inner.Headers == nil {
+		b.inner.Headers = http.Header{}
+	}
+	b.inner.Headers.Set("Accept-Language", strings.Join(languages, ","))
+	return b
+}
+
+// Language returns the preferred language of the Accept-Language of the
+// options, or an empty string.
+func (o Options) Language() string {
+	first, _, _ := strings.Cut(o.Headers.Get("Accept-Language"), ",")
+	first, _, _ = strings.Cut(first, ";")
+	return strings.TrimSpace(first)
+}
+
+// WithBasicAuth sets the HTTP basic authentication credentials.
+func (b *Builder) WithBasicAuth(username, password string) *Builder {
+	b.inner.Username = username
+	b.inner.Password = password
+	return b
+}
+
+// WithBearer sends the token in the Authorization header.
+func (b *Builder) WithBearer(token string) *Builder {
+	return b.WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithScripts runs the JavaScript snippets in the page before capturing
+// its source.
+func (b *Builder) WithScripts(scripts []string) *Builder {
+	b.inner.Scripts = scripts
+	return b
+}
+
+// WithLogin runs the login script before loading the page.
+func (b *Builder) WithLogin(script *LoginScript) *Builder {
+	b.inner.Login = script
+	return b
+}
+
+// WithCookies adds the cookies to the session before loading the page.
+func (b *Builder) WithCookies(cookies []Cookie) *Builder {
+	b.inner.Cookies = cookies
+	return b
+}
+
+// WithSaveCookies captures the cookies of the session after loading the
+// page.
+func (b *Builder) WithSaveCookies(value bool) *Builder {
+	b.inner.SaveCookies = value
+	return b
+}
+
+// WithViewport renders the page at the size of the viewport.
+func (b *Builder) WithViewport(viewport *Viewport) *Builder {
+	b.inner.Viewport = viewport
+	return b
+}
+
+// WithPrintPDF prints the rendered page to a PDF document after capturing
+// its source.
+func (b *Builder) WithPrintPDF(value bool) *Builder {
+	b.inner.PrintPDF = value
+	return b
+}
+
+// WithConsoleLog enables the capture of the messages the page writes to the
+// browser console.
+func (b *Builder) WithConsoleLog(value bool) *Builder {
+	b.inner.ConsoleLog = value
+	return b
+}
+
+// WithFailOnError aborts the run when the page logs a console error matching
+// the pattern while it loads. It enables the console log.
+func (b *Builder) WithFailOnError(pattern *regexp.Regexp) *Builder {
+	b.inner.FailOn = pattern
+	if pattern != nil {
+		b.inner.ConsoleLog = true
+	}
+	return b
+}
+
+// WithPerf enables the capture of the page navigation timing.
+func (b *Builder) WithPerf(value bool) *Builder {
+	b.inner.Perf = value
+	return b
+}
+
+// WithLimits sets the resource limits of the browser processes.
+func (b *Builder) WithLimits(limits Limits) *Builder {
+	b.inner.Limits = limits
+	return b
+}
+
+// Build returns the options.
+func (b *Builder) Build() Options {
+	return b.inner
+}
+
+// Capture is what Load reads from the page.
+type Capture struct {
+	Source      string
+	URL         string
+	ContentType string
+	Metrics     *PerfMetrics
+	Cookies     []Cookie
+	PDF         []byte
+}
+
+// Load navigates to the page through an open WebDriver session, waits for it
+// to render and captures its source. The console function returns the
+// messages logged so far, and is only called when FailOn is set.
+func Load(ctx context.Context, wd selenium.WebDriver, o Options, console func() []ConsoleMessage) (Capture, error) {
+	var c Capture
+
+	if o.Viewport != nil {
+		o.Logger.Debug("Resizing the window", "viewport", o.Viewport.String())
+		if err := wd.ResizeWindow("", o.Viewport.Width, o.Viewport.Height); err != nil {
+			return c, errors.NewPuperError(err, "Can't resize the window")
+		}
+	}
+
+	if o.Login != nil {
+		if err := login(ctx, wd, o); err != nil {
+			return c, err
+		}
+	}
+
+	o.Logger.Debug("Getting webpage")
+	if err := wd.Get(o.credentialsURL()); err != nil {
+		return c, errors.NewPuperError(err, "Failed to load URL")
+	}
+
+	if len(o.Cookies) > 0 {
+		o.Logger.Debug("Adding cookies and reloading", "cookies", len(o.Cookies))
+		addCookies(wd, o)
+		if err := wd.Get(o.credentialsURL()); err != nil {
+			return c, errors.NewPuperError(err, "Failed to load URL")
+		}
+	}
+
+	if len(o.WaitSelectors()) > 0 || o.WaitUntil != nil {
+		if err := wait(ctx, wd, o); err != nil {
+			return c, err
+		}
+	} else {
+		o.Logger.Debug("Waiting for page to load", "seconds", o.Wait)
+		select {
+		case <-ctx.Done():
+			return c, errors.NewPuperError(ctx.Err(), "Interrupted while waiting for the page to load")
+		case <-time.After(time.Duration(o.Wait) * time.Second):
+		}
+	}
+
+	if err := click(ctx, wd, o); err != nil {
+		return c, err
+	}
+
+	if o.ScrollTimes > 0 {
+		o.Logger.Debug("Scrolling the page", "times", o.ScrollTimes, "pause", o.ScrollPause)
+		if err := scroll(ctx, wd, o); err != nil {
+			return c, err
+		}
+	}
+
+	for i, script := range o.Scripts {
+		o.Logger.Debug("Running script", "index", i+1)
+		if _, err := wd.ExecuteScript(script, nil); err != nil {
+			return c, errors.NewPuperError(err, fmt.Sprintf("Script %d failed", i+1))
+		}
+	}
+
+	if o.Perf {
+		o.Logger.Debug("Reading the navigation timing")
+		metrics, err := navigationTiming(wd)
+		if err != nil {
+			o.Logger.Warn("Can't read the navigation timing", "err", err)
+		}
+		c.Metrics = metrics
+	}
+
+	if o.FailOn != nil {
+		for _, message := range console() {
+			if message.IsError() && o.FailOn.MatchString(message.Text) {
+				return c, errors.NewPuperError(fmt.Errorf("%s", message.Text), "The page logged a JavaScript error")
+			}
+		}
+	}
+
+	var err error
+	c.URL, err = wd.CurrentURL()
+	if err != nil {
+		o.Logger.Warn("Can't read the final URL", "err", err)
+		c.URL = o.URL
+	}
+	if u, err := url.Parse(c.URL); err == nil && u.User != nil {
+		u.User = nil
+		c.URL = u.String()
+	}
+
+	c.Source, err = wd.PageSource()
+	if err != nil {
+		return c, errors.NewPuperError(err, "Failed to get page source")
+	}
+
+	if o.SaveCookies {
+		if c.Cookies, err = getCookies(wd); err != nil {
+			o.Logger.Warn("Can't read the cookies", "err", err)
+		}
+	}
+
+	if o.PrintPDF {
+		o.Logger.Debug("Printing the page")
+		if c.PDF, err = printPDF(wd); err != nil {
+			return c, errors.NewPuperError(err, "Can't print the page")
+		}
+	}
+
+	return c, nil
+}
+
+// credentialsURL returns the URL of the page with the basic authentication
+// credentials in it, the only way to hand them to a browser driven through
+// WebDriver.
+func (o Options) credentialsURL() string {
+	if o.Username == "" {
+		return o.URL
+	}
+
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return o.URL
+	}
+	u.User = url.UserPassword(o.Username, o.Password)
+	return u.String()
+}
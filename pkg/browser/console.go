@@ -0,0 +1,12 @@
+package browser
+
+// ConsoleMessage is a message the page wrote to the browser console.
+type ConsoleMessage struct {
+	Level string
+	Text  string
+}
+
+// IsError reports whether the message was logged as an error.
+func (m ConsoleMessage) IsError() bool {
+	return m.Level == "error"
+}
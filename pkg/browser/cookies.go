@@ -0,0 +1,90 @@
+package browser
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/tebeka/selenium"
+)
+
+// Cookie is a cookie of the browser session, as stored in a cookie file.
+type Cookie struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Domain string `json:"domain,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Secure bool   `json:"secure,omitempty"`
+	// Expiry is the expiration time in seconds since the Unix epoch, or zero
+	// for session cookies.
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+// ReadCookies reads a JSON cookie file. A missing file has no cookies.
+func ReadCookies(path string) ([]Cookie, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cookies := []Cookie{}
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return nil, err
+	}
+	return cookies, nil
+}
+
+// WriteCookies writes the cookies to a JSON cookie file, readable only by
+// the user since it may hold session tokens.
+func WriteCookies(path string, cookies []Cookie) error {
+	if cookies == nil {
+		cookies = []Cookie{}
+	}
+
+	data, err := json.MarshalIndent(cookies, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// addCookies adds the cookies to the WebDriver session. WebDriver only
+// accepts cookies for the domain of the current page.
+func addCookies(wd selenium.WebDriver, o Options) {
+	for _, c := range o.Cookies {
+		cookie := &selenium.Cookie{
+			Name:   c.Name,
+			Value:  c.Value,
+			Domain: c.Domain,
+			Path:   c.Path,
+			Secure: c.Secure,
+			Expiry: uint(c.Expiry),
+		}
+		if err := wd.AddCookie(cookie); err != nil {
+			o.Logger.Warn("Can't add the cookie", "name", c.Name, "domain", c.Domain, "err", err)
+		}
+	}
+}
+
+// getCookies returns the cookies of the WebDriver session.
+func getCookies(wd selenium.WebDriver) ([]Cookie, error) {
+	cookies, err := wd.GetCookies()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Cookie{}
+	for _, c := range cookies {
+		result = append(result, Cookie{
+			Name:   c.Name,
+			Value:  c.Value,
+			Domain: c.Domain,
+			Path:   c.Path,
+			Secure: c.Secure,
+			Expiry: int64(c.Expiry),
+		})
+	}
+	return result, nil
+}
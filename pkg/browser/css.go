@@ -0,0 +1,128 @@
+package browser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pseudoClasses are the CSS pseudo-classes browsers understand, the ones
+// `document.querySelector` can take.
+var pseudoClasses = map[string]bool{
+	"active": true, "any-link": true, "autofill": true, "checked": true,
+	"default": true, "defined": true, "dir": true, "disabled": true,
+	"empty": true, "enabled": true, "first-child": true, "first-of-type": true,
+	"focus": true, "focus-visible": true, "focus-within": true,
+	"fullscreen": true, "has": true, "hover": true, "in-range": true,
+	"indeterminate": true, "invalid": true, "is": true, "lang": true,
+	"last-child": true, "last-of-type": true, "link": true, "modal": true,
+	"not": true, "nth-child": true, "nth-last-child": true,
+	"nth-last-of-type": true, "nth-of-type": true, "only-child": true,
+	"only-of-type": true, "optional": true, "out-of-range": true,
+	"paused": true, "placeholder-shown": true, "playing": true,
+	"read-only": true, "read-write": true, "required": true, "root": true,
+	"scope": true, "target": true, "valid": true, "visited": true,
+	"where": true,
+}
+
+// ValidateCSS checks that the selector is one the browser can query, unlike
+// the selectors of the content, which can use combinators as separate
+// arguments and pseudo-classes of their own like `:contains()`. It checks
+// the brackets, the quotes and the pseudo-classes, not the whole grammar.
+func ValidateCSS(selector string) error {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return fmt.Errorf("empty selector")
+	}
+	if strings.ContainsAny(selector[:1], ">+~,") || strings.ContainsAny(selector[len(selector)-1:], ">+~,") {
+		return fmt.Errorf("%s starts or ends with a combinator", selector)
+	}
+
+	var quote rune
+	brackets, parens := 0, 0
+	runes := []rune(selector)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			i++
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			brackets++
+		case r == ']':
+			brackets--
+		case r == '(':
+			parens++
+		case r == ')':
+			parens--
+		case r == ':' && brackets == 0:
+			if i+1 < len(runes) && runes[i+1] == ':' {
+				return fmt.Errorf("%s has a pseudo-element, which never matches an element", selector)
+			}
+			j := i + 1
+			for j < len(runes) && (runes[j] == '-' || runes[j] >= 'a' && runes[j] <= 'z' || runes[j] >= 'A' && runes[j] <= 'Z') {
+				j++
+			}
+			if name := strings.ToLower(string(runes[i+1 : j])); !pseudoClasses[name] {
+				return fmt.Errorf("%s isn't a CSS pseudo-class", ":"+name)
+			}
+			i = j - 1
+		}
+		if brackets < 0 || parens < 0 {
+			return fmt.Errorf("%s has an unmatched %c", selector, r)
+		}
+	}
+
+	switch {
+	case quote != 0:
+		return fmt.Errorf("%s has an unmatched quote", selector)
+	case brackets > 0:
+		return fmt.Errorf("%s has an unmatched [", selector)
+	case parens > 0:
+		return fmt.Errorf("%s has an unmatched (", selector)
+	}
+	return nil
+}
+
+// querySelector returns the part of a content selector the browser can query:
+// the whole selector, the selector without its pseudo-class when only puper
+// knows it, like `p` for `p:contains(Price)`, or an empty string for
+// combinators and selectors left with nothing to query.
+func querySelector(selector string) string {
+	switch selector {
+	case "", "*", ">", "+", ",":
+		return ""
+	}
+	if ValidateCSS(selector) == nil {
+		return selector
+	}
+
+	// The selectors of the content have their pseudo-class at the end.
+	if i := pseudoStart(selector); i > 0 && ValidateCSS(selector[:i]) == nil {
+		return selector[:i]
+	}
+	return ""
+}
+
+// pseudoStart returns the index of the colon starting the pseudo-class of the
+// selector, outside its attribute matchers, or -1.
+func pseudoStart(selector string) int {
+	brackets := 0
+	for i, r := range selector {
+		switch r {
+		case '[':
+			brackets++
+		case ']':
+			brackets--
+		case ':':
+			if brackets == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
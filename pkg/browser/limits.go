@@ -0,0 +1,106 @@
+package browser
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// Limits are the OS-level resource limits applied to the browser processes.
+type Limits struct {
+	// Memory is the maximum memory the processes use together, in bytes,
+	// enforced by the cgroup of a transient systemd scope. Zero means no
+	// limit.
+	Memory int64
+	// Nice is the scheduling priority of the processes, from -20 to 19. Zero
+	// leaves it unchanged.
+	Nice int
+}
+
+// IsZero reports whether no limit is set.
+func (l Limits) IsZero() bool {
+	return l.Memory == 0 && l.Nice == 0
+}
+
+// ParseSize parses a size in bytes, with an optional K, M or G suffix in
+// powers of 1024, like `512M` or `2G`.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return n * multiplier, nil
+}
+
+// ApplyLimits applies the nice value to the process and to its running
+// descendants. Processes started later by any of them inherit it, so
+// applying it to a WebDriver server right after it starts covers the browser
+// it spawns. The memory limit is applied when starting the process instead,
+// see Confine.
+func ApplyLimits(pid int, l Limits) error {
+	if l.Nice == 0 {
+		return nil
+	}
+
+	if err := limit(pid, l); err != nil {
+		return err
+	}
+
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		// The process is already gone.
+		return nil
+	}
+
+	// Children fails when there are none.
+	children, _ := p.Children()
+	for _, child := range children {
+		if err := ApplyLimits(int(child.Pid), l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MemoryScope returns the command that runs another one in a transient
+// systemd scope whose cgroup caps the memory, swap included, of every process
+// in it. It fails when the cgroup v2 memory controller or systemd aren't
+// available, rather than starting the browser without the limit.
+func MemoryScope(memory int64) ([]string, error) {
+	return memoryScope(memory)
+}
+
+// Confine makes the command run in the scope returned by MemoryScope, so the
+// process and the ones it starts can't use more memory than the limit
+// together.
+func Confine(cmd *exec.Cmd, scope []string) {
+	if len(scope) == 0 {
+		return
+	}
+
+	args := append([]string{}, scope...)
+	args = append(args, "--", cmd.Path)
+	cmd.Args = append(args, cmd.Args[1:]...)
+	cmd.Path = scope[0]
+	killWithParent(cmd)
+}
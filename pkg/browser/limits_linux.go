@@ -0,0 +1,50 @@
+package browser
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// memoryScope checks that systemd can create a scope capped at the memory
+// limit, by running `true` in one, and returns the command creating it.
+func memoryScope(memory int64) ([]string, error) {
+	controllers, err := os.ReadFile("/sys/fs/cgroup/cgroup.controllers")
+	if err != nil {
+		return nil, fmt.Errorf("memory limits need cgroup v2, /sys/fs/cgroup isn't a cgroup v2 hierarchy")
+	}
+	if !strings.Contains(" "+strings.TrimSpace(string(controllers))+" ", " memory ") {
+		return nil, fmt.Errorf("memory limits need the cgroup v2 memory controller, which isn't enabled")
+	}
+
+	systemdRun, err := exec.LookPath("systemd-run")
+	if err != nil {
+		return nil, fmt.Errorf("memory limits need systemd-run to create a cgroup: %w", err)
+	}
+
+	scope := []string{systemdRun}
+	if os.Geteuid() != 0 {
+		scope = append(scope, "--user")
+	}
+	scope = append(scope, "--scope", "--quiet", "--collect",
+		fmt.Sprintf("--property=MemoryMax=%d", memory),
+		"--property=MemorySwapMax=0")
+
+	check := exec.Command(scope[0], append(scope[1:], "--", "true")...)
+	if out, err := check.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("can't create a systemd scope for the memory limit: %s", strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+
+	return scope, nil
+}
+
+// killWithParent kills the process when puper dies, so its scope doesn't
+// outlive it.
+func killWithParent(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+}
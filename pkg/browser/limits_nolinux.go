@@ -0,0 +1,15 @@
+//go:build !linux
+
+package browser
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// memoryScope fails, cgroups are only available on Linux.
+func memoryScope(memory int64) ([]string, error) {
+	return nil, fmt.Errorf("memory limits are only supported on Linux")
+}
+
+func killWithParent(cmd *exec.Cmd) {}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package browser
+
+import "fmt"
+
+// limit is not supported on this platform.
+func limit(pid int, l Limits) error {
+	return fmt.Errorf("nice values are not supported on this platform")
+}
@@ -0,0 +1,12 @@
+//go:build unix
+
+package browser
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// limit sets the nice value of the process.
+func limit(pid int, l Limits) error {
+	return unix.Setpriority(unix.PRIO_PROCESS, pid, l.Nice)
+}
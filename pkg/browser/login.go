@@ -0,0 +1,156 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tebeka/selenium"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+)
+
+// LoginScript describes the steps that log into a site before the page gets
+// loaded, like:
+//
+//	url: https://example.com/login
+//	timeout: 10s
+//	steps:
+//	  - fill: {selector: "#user", value: "${SITE_USER}"}
+//	  - fill: {selector: "#password", value: "${SITE_PASSWORD}"}
+//	  - click: "button[type=submit]"
+//	  - wait: "#dashboard"
+type LoginScript struct {
+	// URL is the page the steps start on. The page to load when empty.
+	URL string `yaml:"url" json:"url,omitempty"`
+	// Timeout bounds every wait step. Ten seconds when zero.
+	Timeout time.Duration `yaml:"timeout" json:"timeout,omitempty"`
+	Steps   []LoginStep   `yaml:"steps" json:"steps"`
+}
+
+// LoginStep is a single action of a login script. Only one of its fields is
+// set.
+type LoginStep struct {
+	// Fill types the value into the field matching the selector.
+	Fill *LoginFill `yaml:"fill" json:"fill,omitempty"`
+	// Click clicks the element matching the selector.
+	Click string `yaml:"click" json:"click,omitempty"`
+	// Wait waits for an element matching the selector to show up.
+	Wait string `yaml:"wait" json:"wait,omitempty"`
+	// Sleep pauses for a while.
+	Sleep time.Duration `yaml:"sleep" json:"sleep,omitempty"`
+}
+
+// LoginFill is the field and the value of a fill step.
+type LoginFill struct {
+	Selector string `yaml:"selector" json:"selector"`
+	Value    string `yaml:"value" json:"value"`
+}
+
+// ReadLoginScript reads a login script from a YAML file. The values of the
+// fill steps go through expand, to read secrets from the environment.
+func ReadLoginScript(path string, expand func(string) (string, error)) (*LoginScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var script LoginScript
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&script); err != nil {
+		return nil, err
+	}
+
+	if script.Timeout == 0 {
+		script.Timeout = 10 * time.Second
+	}
+
+	for i, step := range script.Steps {
+		set := 0
+		for _, ok := range []bool{step.Fill != nil, step.Click != "", step.Wait != "", step.Sleep > 0} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("step %d: expected exactly one of fill, click, wait or sleep", i+1)
+		}
+
+		if step.Fill != nil {
+			if step.Fill.Value, err = expand(step.Fill.Value); err != nil {
+				return nil, fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+	}
+
+	return &script, nil
+}
+
+// login runs the login script through the WebDriver session.
+func login(ctx context.Context, wd selenium.WebDriver, o Options) error {
+	script := o.Login
+
+	start := script.URL
+	if start == "" {
+		start = o.credentialsURL()
+	}
+
+	o.Logger.Debug("Running the login script", "url", start, "steps", len(script.Steps))
+	if err := wd.Get(start); err != nil {
+		return errors.NewPuperError(err, "Failed to load the login page")
+	}
+
+	for i, step := range script.Steps {
+		if ctx.Err() != nil {
+			return errors.NewPuperError(ctx.Err(), "Interrupted while logging in")
+		}
+
+		var err error
+		switch {
+		case step.Fill != nil:
+			var element selenium.WebElement
+			if element, err = waitFor(wd, step.Fill.Selector, script.Timeout); err == nil {
+				if err = element.Clear(); err == nil {
+					err = element.SendKeys(step.Fill.Value)
+				}
+			}
+		case step.Click != "":
+			var element selenium.WebElement
+			if element, err = waitFor(wd, step.Click, script.Timeout); err == nil {
+				err = element.Click()
+			}
+		case step.Wait != "":
+			_, err = waitFor(wd, step.Wait, script.Timeout)
+		case step.Sleep > 0:
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(step.Sleep):
+			}
+		}
+
+		if err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Login step %d failed", i+1))
+		}
+	}
+
+	return nil
+}
+
+// waitFor waits for an element matching the selector and returns it.
+func waitFor(wd selenium.WebDriver, selector string, timeout time.Duration) (selenium.WebElement, error) {
+	var element selenium.WebElement
+	err := wd.WaitWithTimeout(func(wd selenium.WebDriver) (bool, error) {
+		var err error
+		element, err = wd.FindElement(selenium.ByCSSSelector, selector)
+		return err == nil, nil
+	}, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("no element matches %s: %w", selector, err)
+	}
+	return element, nil
+}
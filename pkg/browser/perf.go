@@ -0,0 +1,80 @@
+package browser
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tebeka/selenium"
+)
+
+// PerfMetrics holds the navigation timing of the page, as reported by the
+// Performance API.
+type PerfMetrics struct {
+	// TTFB is the time between sending the request and receiving the first
+	// byte of the response.
+	TTFB time.Duration
+	// DOMContentLoaded is the time from the start of the navigation until the
+	// DOMContentLoaded event finished.
+	DOMContentLoaded time.Duration
+	// Load is the time from the start of the navigation until the load event
+	// finished.
+	Load time.Duration
+	// TransferSize is the size of the response, headers included, in bytes.
+	TransferSize int64
+}
+
+// NavigationTimingScript is the body of a function returning the navigation
+// timing entry of the current page, or null.
+const NavigationTimingScript = `
+const [entry] = performance.getEntriesByType("navigation");
+if (!entry) {
+	return null;
+}
+return {
+	ttfb: entry.responseStart - entry.requestStart,
+	domContentLoaded: entry.domContentLoadedEventEnd,
+	load: entry.loadEventEnd,
+	transferSize: entry.transferSize,
+};`
+
+// navigationTiming reads the navigation timing entry of the current page.
+func navigationTiming(wd selenium.WebDriver) (*PerfMetrics, error) {
+	raw, err := wd.ExecuteScriptRaw(NavigationTimingScript, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return nil, err
+	}
+
+	return ParseNavigationTiming(reply.Value)
+}
+
+// ParseNavigationTiming decodes the value returned by NavigationTimingScript.
+// It returns nil when the page had no navigation timing entry.
+func ParseNavigationTiming(value []byte) (*PerfMetrics, error) {
+	var entry *struct {
+		TTFB             float64 `json:"ttfb"`
+		DOMContentLoaded float64 `json:"domContentLoaded"`
+		Load             float64 `json:"load"`
+		TransferSize     int64   `json:"transferSize"`
+	}
+	if err := json.Unmarshal(value, &entry); err != nil || entry == nil {
+		return nil, err
+	}
+
+	milliseconds := func(value float64) time.Duration {
+		return time.Duration(value * float64(time.Millisecond))
+	}
+
+	return &PerfMetrics{
+		TTFB:             milliseconds(entry.TTFB),
+		DOMContentLoaded: milliseconds(entry.DOMContentLoaded),
+		Load:             milliseconds(entry.Load),
+		TransferSize:     entry.TransferSize,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package browser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tebeka/selenium"
+)
+
+// Remote is a WebDriver session along with the URL of the server it's open
+// on, for the commands the client doesn't implement, like printing.
+type Remote struct {
+	selenium.WebDriver
+	Server string
+}
+
+// Execute sends a command the client doesn't implement to the WebDriver
+// server, like `print`, and returns its value.
+func (r Remote) Execute(command string, params interface{}) (json.RawMessage, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	u := strings.TrimSuffix(r.Server, "/") + "/session/" + r.SessionID() + "/" + command
+	response, err := http.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("unexpected answer to the %s command: %s", command, response.Status)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(reply.Value, &failure)
+		return nil, fmt.Errorf("the %s command failed: %s", command, failure.Message)
+	}
+	return reply.Value, nil
+}
+
+// printPDF prints the page to a PDF document with the W3C WebDriver print
+// command, keeping the backgrounds.
+func printPDF(wd selenium.WebDriver) ([]byte, error) {
+	remote, ok := wd.(Remote)
+	if !ok {
+		return nil, fmt.Errorf("the WebDriver server of the session is unknown")
+	}
+
+	value, err := remote.Execute("print", map[string]interface{}{"background": true})
+	if err != nil {
+		return nil, err
+	}
+
+	var encoded string
+	if err := json.Unmarshal(value, &encoded); err != nil {
+		return nil, fmt.Errorf("unexpected answer to the print command: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
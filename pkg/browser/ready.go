@@ -0,0 +1,55 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WaitReady polls the status endpoint of the WebDriver server at url until
+// it reports that it's ready to create sessions. It fails early when the
+// exited channel gets closed, which a nil channel never does.
+func WaitReady(ctx context.Context, url string, timeout time.Duration, exited <-chan struct{}) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		if ready(ctx, url) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return fmt.Errorf("the WebDriver server exited")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// ready asks the WebDriver server whether it's ready.
+func ready(ctx context.Context, url string) bool {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/status", nil)
+	if err != nil {
+		return false
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false
+	}
+	defer response.Body.Close()
+
+	var status struct {
+		Value struct {
+			Ready bool `json:"ready"`
+		} `json:"value"`
+	}
+	if response.StatusCode != http.StatusOK || json.NewDecoder(response.Body).Decode(&status) != nil {
+		return false
+	}
+	return status.Value.Ready
+}
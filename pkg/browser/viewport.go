@@ -0,0 +1,97 @@
+package browser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Viewport is the size of the page the browser renders, in CSS pixels.
+type Viewport struct {
+	Width  int
+	Height int
+	// Scale is the device pixel ratio, 1 for desktops.
+	Scale float64
+	// Mobile emulates a touch screen and makes the page see a mobile
+	// browser, where the drivers support it.
+	Mobile bool
+}
+
+// ParseViewport parses a size like `1280x800`.
+func ParseViewport(s string) (Viewport, error) {
+	width, height, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return Viewport{}, fmt.Errorf("expected WIDTHxHEIGHT, like 1280x800, got %s", s)
+	}
+
+	v := Viewport{Scale: 1}
+	var err error
+	if v.Width, err = strconv.Atoi(width); err != nil || v.Width <= 0 {
+		return Viewport{}, fmt.Errorf("invalid width: %s", width)
+	}
+	if v.Height, err = strconv.Atoi(height); err != nil || v.Height <= 0 {
+		return Viewport{}, fmt.Errorf("invalid height: %s", height)
+	}
+	return v, nil
+}
+
+// String returns the viewport like `390x844 @3x mobile`.
+func (v Viewport) String() string {
+	s := fmt.Sprintf("%dx%d", v.Width, v.Height)
+	if v.Scale != 1 {
+		s += " @" + strconv.FormatFloat(v.Scale, 'f', -1, 64) + "x"
+	}
+	if v.Mobile {
+		s += " mobile"
+	}
+	return s
+}
+
+// Device is a preset of a viewport and the User-Agent of the browser of a
+// device.
+type Device struct {
+	Viewport Viewport
+	// UserAgent is empty for desktops, which keep the one of the browser.
+	UserAgent string
+}
+
+const (
+	iOSUserAgent    = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1"
+	iPadUserAgent   = "Mozilla/5.0 (iPad; CPU OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1"
+	pixelUserAgent  = "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36"
+	galaxyUserAgent = "Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36"
+	tabletUserAgent = "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36"
+)
+
+// Devices are the presets of LookupDevice, by name.
+var Devices = map[string]Device{
+	"iphone-se":         {Viewport{375, 667, 2, true}, iOSUserAgent},
+	"iphone-14":         {Viewport{390, 844, 3, true}, iOSUserAgent},
+	"iphone-14-pro-max": {Viewport{430, 932, 3, true}, iOSUserAgent},
+	"pixel-7":           {Viewport{412, 915, 2.625, true}, pixelUserAgent},
+	"galaxy-s23":        {Viewport{360, 780, 3, true}, galaxyUserAgent},
+	"ipad":              {Viewport{810, 1080, 2, true}, iPadUserAgent},
+	"ipad-pro":          {Viewport{1024, 1366, 2, true}, iPadUserAgent},
+	"galaxy-tab-s8":     {Viewport{800, 1280, 2, true}, tabletUserAgent},
+	"laptop":            {Viewport{1280, 800, 1, false}, ""},
+	"desktop":           {Viewport{1920, 1080, 1, false}, ""},
+}
+
+// LookupDevice returns the preset of a device, like `iphone-14`.
+func LookupDevice(name string) (Device, error) {
+	if device, ok := Devices[strings.ToLower(name)]; ok {
+		return device, nil
+	}
+	return Device{}, fmt.Errorf("unknown device: %s, expected one of %s", name, strings.Join(DeviceNames(), ", "))
+}
+
+// DeviceNames returns the names of the device presets, sorted.
+func DeviceNames() []string {
+	names := []string{}
+	for name := range Devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,220 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tebeka/selenium"
+
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+)
+
+// Events a page can be waited for.
+const (
+	WaitNetworkIdle      = "networkidle"
+	WaitDOMContentLoaded = "domcontentloaded"
+	WaitJS               = "js"
+)
+
+// networkIdleTime is how long the page has to go without loading a resource
+// to be considered idle.
+const networkIdleTime = 500 * time.Millisecond
+
+// WaitUntil is the condition the page is waited for instead of sleeping,
+// like `networkidle` or `js:window.appReady === true`.
+type WaitUntil struct {
+	Event string
+	// Script is the JavaScript expression of the `js` event.
+	Script string
+}
+
+// ParseWaitUntil parses a condition like `networkidle`, `domcontentloaded`
+// or `js:window.appReady === true`.
+func ParseWaitUntil(s string) (*WaitUntil, error) {
+	switch s {
+	case WaitNetworkIdle, WaitDOMContentLoaded:
+		return &WaitUntil{Event: s}, nil
+	}
+
+	if script, ok := strings.CutPrefix(s, WaitJS+":"); ok {
+		if strings.TrimSpace(script) == "" {
+			return nil, fmt.Errorf("empty js condition")
+		}
+		return &WaitUntil{Event: WaitJS, Script: script}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported wait-until condition: %s, expected networkidle, domcontentloaded or js:EXPRESSION", s)
+}
+
+// String returns the condition as parsed by ParseWaitUntil.
+func (w WaitUntil) String() string {
+	if w.Event == WaitJS {
+		return WaitJS + ":" + w.Script
+	}
+	return w.Event
+}
+
+// Predicate returns the body of a JavaScript function that returns true once
+// the condition is met. Polling it is the only way to wait for the network
+// to be idle through WebDriver, so it's done the same way for every driver:
+// the page is idle once it's loaded and no resource started loading for half
+// a second.
+func (w WaitUntil) Predicate() string {
+	switch w.Event {
+	case WaitNetworkIdle:
+		return fmt.Sprintf(`const count = performance.getEntriesByType("resource").length;
+const now = Date.now();
+const state = window.__puperNetworkIdle || (window.__puperNetworkIdle = {count: -1, since: now});
+if (count !== state.count) {
+  state.count = count;
+  state.since = now;
+}
+return document.readyState === "complete" && now - state.since >= %d;`, networkIdleTime.Milliseconds())
+	case WaitDOMContentLoaded:
+		return `return document.readyState !== "loading";`
+	default:
+		return "return !!(" + w.Script + ");"
+	}
+}
+
+// WaitSelectors returns the selectors the page is waited for: the WaitFor
+// ones, or else every selector of the content the browser can query, without
+// the combinators and the pseudo-classes only puper knows.
+func (o Options) WaitSelectors() []string {
+	if len(o.WaitFor) > 0 {
+		return o.WaitFor
+	}
+
+	selectors := []string{}
+	for _, selector := range o.Selectors {
+		if css := querySelector(selector); css != "" {
+			selectors = append(selectors, css)
+		}
+	}
+	return selectors
+}
+
+// SelectorPredicate returns the body of a JavaScript function that returns
+// true once an element matches the selector.
+func SelectorPredicate(selector string) string {
+	quoted, _ := json.Marshal(selector)
+	return fmt.Sprintf("return document.querySelector(%s) !== null;", quoted)
+}
+
+// wait waits for the selectors, then for the WaitUntil condition, polling
+// them through the WebDriver session. Each of them gets WaitTimeout.
+func wait(ctx context.Context, wd selenium.WebDriver, o Options) error {
+	for _, selector := range o.WaitSelectors() {
+		o.Logger.Debug("Waiting for locator", "selector", selector)
+		if err := poll(ctx, wd, o, SelectorPredicate(selector)); err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Timed out waiting for %s", selector))
+		}
+	}
+
+	if o.WaitUntil != nil {
+		o.Logger.Debug("Waiting for the page", "until", o.WaitUntil.String())
+		if err := poll(ctx, wd, o, o.WaitUntil.Predicate()); err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Timed out waiting until %s", o.WaitUntil))
+		}
+	}
+
+	return nil
+}
+
+// poll runs the predicate every Poll until it returns true or WaitTimeout
+// passes.
+func poll(ctx context.Context, wd selenium.WebDriver, o Options, predicate string) error {
+	deadline := time.Now().Add(o.WaitTimeout)
+	for {
+		result, err := wd.ExecuteScript(predicate, nil)
+		if err != nil {
+			return err
+		}
+		if ok, _ := result.(bool); ok {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still waiting after %s", o.WaitTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.Poll):
+		}
+	}
+}
+
+// ScrollScript is the body of a JavaScript function that scrolls to the
+// bottom of the page and returns its height.
+const ScrollScript = `window.scrollTo(0, document.documentElement.scrollHeight);
+return document.documentElement.scrollHeight;`
+
+// scroll scrolls to the bottom of the page through the WebDriver session
+// ScrollTimes times, pausing ScrollPause each time for the content to load.
+// It stops early once the page stops growing.
+func scroll(ctx context.Context, wd selenium.WebDriver, o Options) error {
+	height := -1.0
+	for i := 0; i < o.ScrollTimes; i++ {
+		result, err := wd.ExecuteScript(ScrollScript, nil)
+		if err != nil {
+			return errors.NewPuperError(err, "Can't scroll the page")
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.NewPuperError(ctx.Err(), "Interrupted while scrolling the page")
+		case <-time.After(o.ScrollPause):
+		}
+
+		current, _ := result.(float64)
+		if current == height {
+			o.Logger.Debug("The page stopped growing", "scrolls", i+1)
+			return nil
+		}
+		height = current
+	}
+	return nil
+}
+
+// ClickPredicate returns the body of a JavaScript function that clicks the
+// first element matching the selector and tells whether there was one.
+func ClickPredicate(selector string) string {
+	quoted, _ := json.Marshal(selector)
+	return fmt.Sprintf(`const element = document.querySelector(%s);
+if (element === null) {
+  return false;
+}
+element.scrollIntoView({block: "center"});
+element.click();
+return true;`, quoted)
+}
+
+// click clicks the first element matching each of the Click selectors
+// through the WebDriver session, pausing ClickDelay after each of them.
+// Selectors matching nothing, like a consent banner that isn't shown, are
+// skipped with a warning.
+func click(ctx context.Context, wd selenium.WebDriver, o Options) error {
+	for _, selector := range o.Click {
+		o.Logger.Debug("Clicking", "selector", selector)
+		result, err := wd.ExecuteScript(ClickPredicate(selector), nil)
+		if err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Can't click %s", selector))
+		}
+		if clicked, _ := result.(bool); !clicked {
+			o.Logger.Warn("Nothing to click", "selector", selector)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.NewPuperError(ctx.Err(), "Interrupted while clicking")
+		case <-time.After(o.ClickDelay):
+		}
+	}
+	return nil
+}
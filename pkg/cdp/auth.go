@@ -0,0 +1,135 @@
+package cdp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	cdproto "github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/chromedp"
+)
+
+// interceptor sends the credentials only to the origin of the page, not to
+// the scripts, CDNs and redirects of other origins it loads. Requests get
+// paused through the Fetch domain: the Authorization header is added to the
+// ones of the origin, and the basic authentication challenges of the origin
+// are answered with the credentials.
+type interceptor struct {
+	origin             string
+	headers            http.Header
+	authorization      string
+	username, password string
+
+	mu sync.Mutex
+	// answered are the requests whose challenge got the credentials, so wrong
+	// ones get cancelled instead of retried forever.
+	answered map[fetch.RequestID]bool
+}
+
+// newInterceptor returns the interceptor for the options, or nil if there
+// are no credentials to scope.
+func (c *cdp) newInterceptor() *interceptor {
+	authorization := c.Headers.Get("Authorization")
+	if authorization == "" && c.Username == "" {
+		return nil
+	}
+
+	headers := c.Headers.Clone()
+	headers.Del("Authorization")
+	return &interceptor{
+		origin:        origin(c.URL),
+		headers:       headers,
+		authorization: authorization,
+		username:      c.Username,
+		password:      c.Password,
+		answered:      map[fetch.RequestID]bool{},
+	}
+}
+
+// enable starts pausing the requests of the tab.
+func (i *interceptor) enable(ctx context.Context) error {
+	chromedp.ListenTarget(ctx, func(event interface{}) {
+		switch e := event.(type) {
+		case *fetch.EventRequestPaused:
+			go i.run(ctx, i.continueRequest(e))
+		case *fetch.EventAuthRequired:
+			go i.run(ctx, i.continueWithAuth(e))
+		}
+	})
+
+	return chromedp.Run(ctx, fetch.Enable().WithHandleAuthRequests(i.username != ""))
+}
+
+// run runs the action from an event listener, which can't block.
+func (i *interceptor) run(ctx context.Context, action chromedp.Action) {
+	target := chromedp.FromContext(ctx).Target
+	action.Do(cdproto.WithExecutor(ctx, target))
+}
+
+// continueRequest resumes the request with the headers of the page, and the
+// Authorization header if it goes to the origin of the page.
+func (i *interceptor) continueRequest(e *fetch.EventRequestPaused) chromedp.Action {
+	headers := http.Header{}
+	for name, value := range e.Request.Headers {
+		if s, ok := value.(string); ok {
+			headers.Set(name, s)
+		}
+	}
+	for name, values := range i.headers {
+		headers[http.CanonicalHeaderKey(name)] = values
+	}
+	if i.authorization != "" {
+		if origin(e.Request.URL) == i.origin {
+			headers.Set("Authorization", i.authorization)
+		} else if headers.Get("Authorization") == i.authorization {
+			// Redirects keep the headers of the request they come from.
+			headers.Del("Authorization")
+		}
+	}
+
+	entries := []*fetch.HeaderEntry{}
+	for name, values := range headers {
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: strings.Join(values, ", ")})
+	}
+	return fetch.ContinueRequest(e.RequestID).WithHeaders(entries)
+}
+
+// continueWithAuth answers the challenges of the origin of the page with the
+// credentials, once, and lets the browser cancel the other ones.
+func (i *interceptor) continueWithAuth(e *fetch.EventAuthRequired) chromedp.Action {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	response := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseCancelAuth}
+	challenge := e.AuthChallenge
+	if challenge.Source == fetch.AuthChallengeSourceServer && origin(challenge.Origin) == i.origin && !i.answered[e.RequestID] {
+		i.answered[e.RequestID] = true
+		response = &fetch.AuthChallengeResponse{
+			Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+			Username: i.username,
+			Password: i.password,
+		}
+	}
+	return fetch.ContinueWithAuth(e.RequestID, response)
+}
+
+// origin returns the scheme and the host of the URL, without the default
+// port of the scheme, the way browsers compare origins.
+func origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := strings.ToLower(u.Host)
+	switch {
+	case u.Scheme == "http" && strings.HasSuffix(host, ":80"):
+		host = strings.TrimSuffix(host, ":80")
+	case u.Scheme == "https" && strings.HasSuffix(host, ":443"):
+		host = strings.TrimSuffix(host, ":443")
+	}
+	return u.Scheme + "://" + host
+}
@@ -0,0 +1,502 @@
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	cdproto "github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+)
+
+type cdp struct {
+	browser.Options
+	mu      sync.Mutex
+	console []browser.ConsoleMessage
+	capture browser.Capture
+}
+
+// New returns a driver that renders the page with headless Chrome, talking
+// the Chrome DevTools Protocol to it directly instead of going through a
+// WebDriver server.
+func New(o browser.Options) *cdp {
+	return &cdp{Options: o}
+}
+
+// Run starts Chrome and fetches the page source. Cancelling the context
+// closes Chrome. When attached to a running browser through RemoteURL, the
+// page loads in a new tab which gets closed instead.
+func (c *cdp) Run(ctx context.Context) error {
+	if c.RemoteURL != "" {
+		if err := checkEndpoint(ctx, c.RemoteURL); err != nil {
+			return errors.NewPuperError(err, "Can't attach to the browser")
+		}
+	}
+
+	var scope []string
+	if c.Limits.Memory > 0 && c.RemoteURL == "" {
+		var err error
+		if scope, err = browser.MemoryScope(c.Limits.Memory); err != nil {
+			return errors.NewPuperError(err, "Can't limit the browser memory")
+		}
+	}
+
+	allocCtx, cancelAlloc := c.allocate(ctx, scope)
+	defer cancelAlloc()
+
+	tabCtx, cancelTab := chromedp.NewContext(allocCtx, chromedp.WithLogf(c.Logger.Debugf))
+	defer cancelTab()
+
+	if c.ConsoleLog {
+		chromedp.ListenTarget(tabCtx, c.listen)
+	}
+
+	if c.Limits.Nice != 0 && c.RemoteURL == "" {
+		// Running no action only starts Chrome, so the nice value applies
+		// before the page loads.
+		if err := chromedp.Run(tabCtx); err != nil {
+			return errors.NewPuperError(err, "Failed to start Chrome")
+		}
+
+		pid := chromedp.FromContext(tabCtx).Browser.Process().Pid
+		if err := browser.ApplyLimits(pid, c.Limits); err != nil {
+			return errors.NewPuperError(err, "Can't limit the browser resources")
+		}
+	}
+
+	if err := c.load(tabCtx); err != nil {
+		if ctx.Err() != nil {
+			return errors.NewPuperError(ctx.Err(), "Chrome was interrupted")
+		}
+		return err
+	}
+	return nil
+}
+
+// allocate returns the context of the browser the tabs get created in. A
+// started Chrome runs in the memory scope, if any.
+func (c *cdp) allocate(ctx context.Context, scope []string) (context.Context, context.CancelFunc) {
+	if c.RemoteURL != "" {
+		if !c.Limits.IsZero() {
+			c.Logger.Warn("The resource limits don't apply to an attached browser")
+		}
+
+		c.Logger.Debug("Attaching to the browser", "url", c.RemoteURL)
+		return chromedp.NewRemoteAllocator(ctx, c.RemoteURL)
+	}
+
+	opts := append([]chromedp.ExecAllocatorOption{}, chromedp.DefaultExecAllocatorOptions[:]...)
+	if c.Binary != "" {
+		opts = append(opts, chromedp.ExecPath(c.Binary))
+	}
+	if c.Proxy != "" {
+		opts = append(opts, chromedp.ProxyServer(c.Proxy))
+	}
+	if userAgent := c.Headers.Get("User-Agent"); userAgent != "" {
+		opts = append(opts, chromedp.UserAgent(userAgent))
+	}
+	if language := c.Language(); language != "" {
+		opts = append(opts, chromedp.Flag("lang", language))
+	}
+	if c.Viewport != nil {
+		opts = append(opts, chromedp.WindowSize(c.Viewport.Width, c.Viewport.Height))
+	}
+	if len(scope) > 0 {
+		opts = append(opts, chromedp.ModifyCmdFunc(func(cmd *exec.Cmd) {
+			browser.Confine(cmd, scope)
+		}))
+	}
+
+	c.Logger.Debug("Starting Chrome through the DevTools Protocol")
+	return chromedp.NewExecAllocator(ctx, opts...)
+}
+
+func (c *cdp) load(ctx context.Context) error {
+	// The credentials are only sent to the origin of the page, so the headers
+	// get added to each request instead of to every one of the tab.
+	if i := c.newInterceptor(); i != nil {
+		if err := i.enable(ctx); err != nil {
+			return errors.NewPuperError(err, "Can't set the request headers")
+		}
+	} else if len(c.Headers) > 0 {
+		headers := network.Headers{}
+		for name, values := range c.Headers {
+			headers[name] = strings.Join(values, ", ")
+		}
+		if err := chromedp.Run(ctx, network.Enable(), network.SetExtraHTTPHeaders(headers)); err != nil {
+			return errors.NewPuperError(err, "Can't set the request headers")
+		}
+	}
+
+	if c.Viewport != nil {
+		if err := chromedp.Run(ctx, c.emulate()); err != nil {
+			return errors.NewPuperError(err, "Can't emulate the viewport")
+		}
+	}
+
+	if len(c.Cookies) > 0 {
+		cookies := []*network.CookieParam{}
+		for _, cookie := range c.Cookies {
+			param := &network.CookieParam{
+				Name:   cookie.Name,
+				Value:  cookie.Value,
+				Domain: cookie.Domain,
+				Path:   cookie.Path,
+				Secure: cookie.Secure,
+			}
+			if cookie.Domain == "" {
+				param.URL = c.URL
+			}
+			if cookie.Expiry > 0 {
+				expires := cdproto.TimeSinceEpoch(time.Unix(cookie.Expiry, 0))
+				param.Expires = &expires
+			}
+			cookies = append(cookies, param)
+		}
+		if err := chromedp.Run(ctx, network.SetCookies(cookies)); err != nil {
+			return errors.NewPuperError(err, "Can't add the cookies")
+		}
+	}
+
+	if c.Login != nil {
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+	}
+
+	c.Logger.Debug("Getting webpage")
+	if err := chromedp.Run(ctx, chromedp.Navigate(c.URL)); err != nil {
+		return errors.NewPuperError(err, "Failed to load URL")
+	}
+
+	if len(c.WaitSelectors()) > 0 || c.WaitUntil != nil {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+	} else {
+		c.Logger.Debug("Waiting for page to load", "seconds", c.Wait)
+		if err := chromedp.Run(ctx, chromedp.Sleep(time.Duration(c.Wait)*time.Second)); err != nil {
+			return errors.NewPuperError(err, "Interrupted while waiting for the page to load")
+		}
+	}
+
+	if err := c.click(ctx); err != nil {
+		return err
+	}
+
+	if c.ScrollTimes > 0 {
+		c.Logger.Debug("Scrolling the page", "times", c.ScrollTimes, "pause", c.ScrollPause)
+		if err := c.scroll(ctx); err != nil {
+			return err
+		}
+	}
+
+	for i, script := range c.Scripts {
+		c.Logger.Debug("Running script", "index", i+1)
+		err := chromedp.Run(ctx, chromedp.Evaluate("(async () => {"+script+"})()", nil, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}))
+		if err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Script %d failed", i+1))
+		}
+	}
+
+	if c.Perf {
+		c.Logger.Debug("Reading the navigation timing")
+		var raw json.RawMessage
+		err := chromedp.Run(ctx, chromedp.Evaluate("(() => {"+browser.NavigationTimingScript+"})()", &raw))
+		if err == nil {
+			c.capture.Metrics, err = browser.ParseNavigationTiming(raw)
+		}
+		if err != nil {
+			c.Logger.Warn("Can't read the navigation timing", "err", err)
+		}
+	}
+
+	if c.FailOn != nil {
+		for _, message := range c.GetConsoleMessages() {
+			if message.IsError() && c.FailOn.MatchString(message.Text) {
+				return errors.NewPuperError(fmt.Errorf("%s", message.Text), "The page logged a JavaScript error")
+			}
+		}
+	}
+
+	err := chromedp.Run(ctx,
+		chromedp.Location(&c.capture.URL),
+		chromedp.OuterHTML("html", &c.capture.Source, chromedp.ByQuery),
+	)
+	if err != nil {
+		return errors.NewPuperError(err, "Failed to get page source")
+	}
+
+	if c.SaveCookies {
+		var cookies []*network.Cookie
+		err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) (err error) {
+			cookies, err = network.GetCookies().Do(ctx)
+			return err
+		}))
+		if err != nil {
+			c.Logger.Warn("Can't read the cookies", "err", err)
+		}
+
+		c.capture.Cookies = []browser.Cookie{}
+		for _, cookie := range cookies {
+			saved := browser.Cookie{
+				Name:   cookie.Name,
+				Value:  cookie.Value,
+				Domain: cookie.Domain,
+				Path:   cookie.Path,
+				Secure: cookie.Secure,
+			}
+			if !cookie.Session {
+				saved.Expiry = int64(cookie.Expires)
+			}
+			c.capture.Cookies = append(c.capture.Cookies, saved)
+		}
+	}
+
+	if c.PrintPDF {
+		c.Logger.Debug("Printing the page")
+		err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) (err error) {
+			c.capture.PDF, _, err = page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+			return err
+		}))
+		if err != nil {
+			return errors.NewPuperError(err, "Can't print the page")
+		}
+	}
+
+	return nil
+}
+
+// wait waits for the selectors, then for the WaitUntil condition, polling
+// them in the tab. Each of them gets WaitTimeout.
+func (c *cdp) wait(ctx context.Context) error {
+	for _, selector := range c.WaitSelectors() {
+		c.Logger.Debug("Waiting for locator", "selector", selector)
+		if err := c.poll(ctx, browser.SelectorPredicate(selector)); err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Timed out waiting for %s", selector))
+		}
+	}
+
+	if c.WaitUntil != nil {
+		c.Logger.Debug("Waiting for the page", "until", c.WaitUntil.String())
+		if err := c.poll(ctx, c.WaitUntil.Predicate()); err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Timed out waiting until %s", c.WaitUntil))
+		}
+	}
+
+	return nil
+}
+
+// poll runs the predicate every Poll until it returns true or WaitTimeout
+// passes.
+func (c *cdp) poll(ctx context.Context, predicate string) error {
+	expression := "(() => {" + predicate + "})()"
+	deadline := time.Now().Add(c.WaitTimeout)
+	for {
+		var ok bool
+		if err := chromedp.Run(ctx, chromedp.Evaluate(expression, &ok)); err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still waiting after %s", c.WaitTimeout)
+		}
+
+		if err := chromedp.Run(ctx, chromedp.Sleep(c.Poll)); err != nil {
+			return err
+		}
+	}
+}
+
+// click clicks the first element matching each of the Click selectors,
+// pausing ClickDelay after each of them. Selectors matching nothing are
+// skipped with a warning.
+func (c *cdp) click(ctx context.Context) error {
+	for _, selector := range c.Click {
+		c.Logger.Debug("Clicking", "selector", selector)
+		var clicked bool
+		if err := chromedp.Run(ctx, chromedp.Evaluate("(() => {"+browser.ClickPredicate(selector)+"})()", &clicked)); err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Can't click %s", selector))
+		}
+		if !clicked {
+			c.Logger.Warn("Nothing to click", "selector", selector)
+			continue
+		}
+
+		if err := chromedp.Run(ctx, chromedp.Sleep(c.ClickDelay)); err != nil {
+			return errors.NewPuperError(err, "Interrupted while clicking")
+		}
+	}
+	return nil
+}
+
+// scroll scrolls to the bottom of the page ScrollTimes times, pausing
+// ScrollPause each time for the content to load. It stops early once the
+// page stops growing.
+func (c *cdp) scroll(ctx context.Context) error {
+	height := -1.0
+	for i := 0; i < c.ScrollTimes; i++ {
+		var current float64
+		if err := chromedp.Run(ctx, chromedp.Evaluate("(() => {"+browser.ScrollScript+"})()", &current)); err != nil {
+			return errors.NewPuperError(err, "Can't scroll the page")
+		}
+
+		if err := chromedp.Run(ctx, chromedp.Sleep(c.ScrollPause)); err != nil {
+			return errors.NewPuperError(err, "Interrupted while scrolling the page")
+		}
+
+		if current == height {
+			c.Logger.Debug("The page stopped growing", "scrolls", i+1)
+			return nil
+		}
+		height = current
+	}
+	return nil
+}
+
+// login runs the login script in the tab.
+func (c *cdp) login(ctx context.Context) error {
+	script := c.Login
+
+	start := script.URL
+	if start == "" {
+		start = c.URL
+	}
+
+	c.Logger.Debug("Running the login script", "url", start, "steps", len(script.Steps))
+	if err := chromedp.Run(ctx, chromedp.Navigate(start)); err != nil {
+		return errors.NewPuperError(err, "Failed to load the login page")
+	}
+
+	for i, step := range script.Steps {
+		var action chromedp.Action
+		switch {
+		case step.Fill != nil:
+			action = chromedp.Tasks{
+				chromedp.WaitVisible(step.Fill.Selector, chromedp.ByQuery),
+				chromedp.SetValue(step.Fill.Selector, "", chromedp.ByQuery),
+				chromedp.SendKeys(step.Fill.Selector, step.Fill.Value, chromedp.ByQuery),
+			}
+		case step.Click != "":
+			action = chromedp.Click(step.Click, chromedp.ByQuery)
+		case step.Wait != "":
+			action = chromedp.WaitVisible(step.Wait, chromedp.ByQuery)
+		default:
+			action = chromedp.Sleep(step.Sleep)
+		}
+
+		stepCtx, cancel := context.WithTimeout(ctx, script.Timeout+step.Sleep)
+		err := chromedp.Run(stepCtx, action)
+		cancel()
+		if err != nil {
+			return errors.NewPuperError(err, fmt.Sprintf("Login step %d failed", i+1))
+		}
+	}
+
+	return nil
+}
+
+// listen records the console API calls and the uncaught exceptions.
+func (c *cdp) listen(event interface{}) {
+	var message browser.ConsoleMessage
+	switch e := event.(type) {
+	case *runtime.EventConsoleAPICalled:
+		args := []string{}
+		for _, arg := range e.Args {
+			var s string
+			if json.Unmarshal(arg.Value, &s) == nil {
+				args = append(args, s)
+			} else if arg.Value != nil {
+				args = append(args, string(arg.Value))
+			} else {
+				args = append(args, arg.Description)
+			}
+		}
+		message = browser.ConsoleMessage{Level: string(e.Type), Text: strings.Join(args, " ")}
+	case *runtime.EventExceptionThrown:
+		message = browser.ConsoleMessage{Level: "error", Text: e.ExceptionDetails.Error()}
+	default:
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.console = append(c.console, message)
+}
+
+// GetConsoleMessages returns the console messages captured while running the
+// `Run` method, if the console log was enabled.
+func (c *cdp) GetConsoleMessages() []browser.ConsoleMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]browser.ConsoleMessage{}, c.console...)
+}
+
+// emulate returns the actions rendering the page at the size of the viewport,
+// as the device it is. Attached browsers keep their User-Agent otherwise.
+func (c *cdp) emulate() chromedp.Tasks {
+	opts := []chromedp.EmulateViewportOption{chromedp.EmulateScale(c.Viewport.Scale)}
+	if c.Viewport.Mobile {
+		opts = append(opts, chromedp.EmulateMobile, chromedp.EmulateTouch)
+	}
+
+	tasks := chromedp.Tasks{chromedp.EmulateViewport(int64(c.Viewport.Width), int64(c.Viewport.Height), opts...)}
+	if userAgent := c.Headers.Get("User-Agent"); userAgent != "" {
+		tasks = append(tasks, emulation.SetUserAgentOverride(userAgent))
+	}
+	return tasks
+}
+
+// GetContentType returns an empty string, the browser renders every page as
+// HTML.
+func (c *cdp) GetContentType() string {
+	return ""
+}
+
+// GetCookies returns the cookies of the session captured while running the
+// `Run` method, if they were requested.
+func (c *cdp) GetCookies() []browser.Cookie {
+	return c.capture.Cookies
+}
+
+// GetPDF returns the page printed while running the `Run` method, if it was
+// requested.
+func (c *cdp) GetPDF() []byte {
+	return c.capture.PDF
+}
+
+// GetPerfMetrics returns the navigation timing captured while running the
+// `Run` method, or nil if it wasn't requested or available.
+func (c *cdp) GetPerfMetrics() *browser.PerfMetrics {
+	return c.capture.Metrics
+}
+
+// GetSource returns the source found after running the `Run` method.
+func (c *cdp) GetSource() string {
+	return c.capture.Source
+}
+
+// GetURL returns the URL of the page after following redirects, or the
+// requested one if it wasn't fetched yet.
+func (c *cdp) GetURL() string {
+	if c.capture.URL == "" {
+		return c.URL
+	}
+	return c.capture.URL
+}
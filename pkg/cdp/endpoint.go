@@ -0,0 +1,87 @@
+package cdp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// probeTimeout is how long each check of checkEndpoint waits for the server.
+const probeTimeout = 2 * time.Second
+
+// checkEndpoint tells whether the server at the WebSocket URL talks the
+// Chrome DevTools Protocol, the only one attaching supports. Marionette and
+// Playwright browser servers fail with an error naming them instead of a
+// failed DevTools handshake.
+func checkEndpoint(ctx context.Context, remoteURL string) error {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return err
+	}
+
+	// The URLs Chrome prints, like ws://host:9222/devtools/browser/ID.
+	if strings.HasPrefix(u.Path, "/devtools/") {
+		return nil
+	}
+
+	if isDevTools(ctx, u) {
+		return nil
+	}
+
+	if isMarionette(ctx, u.Host) {
+		return fmt.Errorf("%s is a Marionette server, attaching only supports the Chrome DevTools Protocol. Use --webdriver-url with a geckodriver started with --connect-existing instead", remoteURL)
+	}
+
+	return fmt.Errorf("%s isn't a Chrome DevTools endpoint, like ws://host:9222/devtools/browser/ID. Playwright browser servers and Marionette aren't supported", remoteURL)
+}
+
+// isDevTools tells whether the host answers the DevTools version endpoint,
+// which chromedp uses to find the browser URL.
+func isDevTools(ctx context.Context, u *url.URL) bool {
+	scheme := "http"
+	if u.Scheme == "wss" {
+		scheme = "https"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+u.Host+"/json/version", nil)
+	if err != nil {
+		return false
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false
+	}
+	defer response.Body.Close()
+
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if response.StatusCode != http.StatusOK || json.NewDecoder(response.Body).Decode(&version) != nil {
+		return false
+	}
+	return version.WebSocketDebuggerURL != ""
+}
+
+// isMarionette tells whether the host greets new connections the way
+// Marionette does, like `50:{"applicationType":"gecko","marionetteProtocol":3}`.
+func isMarionette(ctx context.Context, host string) bool {
+	conn, err := (&net.Dialer{Timeout: probeTimeout}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(probeTimeout))
+	greeting := make([]byte, 256)
+	n, _ := conn.Read(greeting)
+	return bytes.Contains(greeting[:n], []byte(`"marionetteProtocol"`))
+}
@@ -0,0 +1,243 @@
+package chromedriver
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/tebeka/selenium"
+	"github.com/tebeka/selenium/chrome"
+	"github.com/tebeka/selenium/log"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/net"
+)
+
+type chromedriver struct {
+	browser.Options
+	console []browser.ConsoleMessage
+	capture browser.Capture
+}
+
+// New returns a driver that renders the page with headless Chrome.
+func New(o browser.Options) *chromedriver {
+	return &chromedriver{Options: o}
+}
+
+// Run starts chromedriver and fetches the page source. Cancelling the context
+// kills chromedriver, which aborts the WebDriver session.
+func (c *chromedriver) Run(ctx context.Context) error {
+	if c.RemoteURL != "" {
+		if !c.Limits.IsZero() {
+			c.Logger.Warn("Resource limits don't apply to a remote WebDriver server")
+		}
+		return c.webdriver(ctx, c.RemoteURL)
+	}
+
+	if c.Port == 0 {
+		port, err := net.GetRandomUnusedPort(c.Bind)
+		if err != nil {
+			return errors.NewPuperError(err, "Can't get a random unused port from the OS")
+		}
+		c.Port = port
+	}
+
+	c.Logger.Debug("Prepare the chromedriver command.")
+	binary := "chromedriver"
+	if c.Driver != "" {
+		binary = c.Driver
+	}
+
+	command := exec.CommandContext(ctx, binary, fmt.Sprintf("--port=%d", c.Port))
+	command.Args = append(command.Args, c.DriverArgs...)
+
+	if c.Limits.Memory > 0 {
+		scope, err := browser.MemoryScope(c.Limits.Memory)
+		if err != nil {
+			return errors.NewPuperError(err, "Can't limit the browser memory")
+		}
+		browser.Confine(command, scope)
+	}
+
+	c.Logger.Debug("", "$", strings.Join(command.Args, " "))
+	if err := command.Start(); err != nil {
+		return errors.NewPuperError(err, "Failed to start chromedriver")
+	}
+
+	defer func() {
+		c.Logger.Debug("Killing chromedriver")
+		command.Process.Kill()
+	}()
+
+	if err := browser.ApplyLimits(command.Process.Pid, c.Limits); err != nil {
+		return errors.NewPuperError(err, "Can't limit the browser resources")
+	}
+
+	url := fmt.Sprintf("http://localhost:%d", c.Port)
+	if err := browser.WaitReady(ctx, url, c.StartupTimeout, nil); err != nil {
+		return errors.NewPuperError(err, "Chromedriver didn't start")
+	}
+
+	if err := c.webdriver(ctx, url); err != nil {
+		if ctx.Err() != nil {
+			return errors.NewPuperError(ctx.Err(), "Chromedriver was interrupted")
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *chromedriver) webdriver(ctx context.Context, url string) error {
+	args := []string{"--headless=new", "--disable-gpu"}
+	if c.Proxy != "" {
+		args = append(args, "--proxy-server="+c.Proxy)
+	}
+
+	prefs := map[string]interface{}{}
+	for name, values := range c.Headers {
+		switch name {
+		case "Accept-Language":
+			prefs["intl.accept_languages"] = strings.Join(values, ",")
+			// The language of the interface is the one of navigator.language.
+			args = append(args, "--lang="+c.Language())
+		case "User-Agent":
+			args = append(args, "--user-agent="+values[0])
+		}
+	}
+
+	options := chrome.Capabilities{Path: c.Binary, Args: args, Prefs: prefs, W3C: true}
+	if c.Viewport != nil && c.Viewport.Mobile {
+		options.MobileEmulation = &chrome.MobileEmulation{
+			DeviceMetrics: &chrome.DeviceMetrics{
+				Width:      uint(c.Viewport.Width),
+				Height:     uint(c.Viewport.Height),
+				PixelRatio: c.Viewport.Scale,
+			},
+			UserAgent: c.Headers.Get("User-Agent"),
+		}
+	}
+
+	caps := selenium.Capabilities{"browserName": "chrome"}
+	caps.AddChrome(options)
+	if c.ConsoleLog {
+		caps["goog:loggingPrefs"] = map[string]string{string(log.Browser): string(log.All)}
+	}
+
+	c.Logger.Debug("Creating webdriver client connection", "url", url)
+	wd, err := selenium.NewRemote(caps, url)
+	if err != nil {
+		return errors.NewPuperError(err, "Failed to create WebDriver client")
+	}
+
+	defer func() {
+		c.Logger.Debug("Quitting webdriver client")
+		wd.Quit()
+	}()
+
+	console := func() []browser.ConsoleMessage {
+		c.readConsole(wd)
+		return c.console
+	}
+
+	remote := browser.Remote{WebDriver: wd, Server: url}
+	if err := c.setHeaders(remote); err != nil {
+		return errors.NewPuperError(err, "Can't set the request headers")
+	}
+
+	c.capture, err = browser.Load(ctx, remote, c.Options, console)
+	if c.ConsoleLog {
+		c.readConsole(wd)
+	}
+	return err
+}
+
+// setHeaders adds the custom headers to every request of the session through
+// the DevTools Protocol, which chromedriver forwards to Chrome. The
+// User-Agent and the languages are set through the browser flags instead.
+func (c *chromedriver) setHeaders(remote browser.Remote) error {
+	headers := map[string]string{}
+	for name, values := range c.Headers {
+		if name != "User-Agent" && name != "Accept-Language" {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+
+	c.Logger.Debug("Setting the request headers", "headers", len(headers))
+	if _, err := remote.Execute("goog/cdp/execute", map[string]interface{}{"cmd": "Network.enable", "params": map[string]interface{}{}}); err != nil {
+		return err
+	}
+	_, err := remote.Execute("goog/cdp/execute", map[string]interface{}{
+		"cmd":    "Network.setExtraHTTPHeaders",
+		"params": map[string]interface{}{"headers": headers},
+	})
+	return err
+}
+
+// readConsole appends the browser log entries written since the last call.
+func (c *chromedriver) readConsole(wd selenium.WebDriver) {
+	messages, err := wd.Log(log.Browser)
+	if err != nil {
+		c.Logger.Warn("Can't read the browser console", "err", err)
+		return
+	}
+
+	for _, m := range messages {
+		level := strings.ToLower(string(m.Level))
+		switch m.Level {
+		case log.Severe:
+			level = "error"
+		case log.Warning:
+			level = "warning"
+		}
+		c.console = append(c.console, browser.ConsoleMessage{Level: level, Text: m.Message})
+	}
+}
+
+// GetConsoleMessages returns the console messages captured while running the
+// `Run` method, if the console log was enabled.
+func (c *chromedriver) GetConsoleMessages() []browser.ConsoleMessage {
+	return c.console
+}
+
+// GetContentType returns an empty string, the browser renders every page as
+// HTML.
+func (c *chromedriver) GetContentType() string {
+	return ""
+}
+
+// GetCookies returns the cookies of the session captured while running the
+// `Run` method, if they were requested.
+func (c *chromedriver) GetCookies() []browser.Cookie {
+	return c.capture.Cookies
+}
+
+// GetPDF returns the page printed while running the `Run` method, if it was
+// requested.
+func (c *chromedriver) GetPDF() []byte {
+	return c.capture.PDF
+}
+
+// GetPerfMetrics returns the navigation timing captured while running the
+// `Run` method, or nil if it wasn't requested or available.
+func (c *chromedriver) GetPerfMetrics() *browser.PerfMetrics {
+	return c.capture.Metrics
+}
+
+// GetSource returns the source found after running the `Run` method.
+func (c *chromedriver) GetSource() string {
+	return c.capture.Source
+}
+
+// GetURL returns the URL of the page after following redirects, or the
+// requested one if it wasn't fetched yet.
+func (c *chromedriver) GetURL() string {
+	if c.capture.URL == "" {
+		return c.URL
+	}
+	return c.capture.URL
+}
@@ -0,0 +1,512 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/html"
+	"github.com/cloudbridgeuy/puper/pkg/output"
+	"github.com/cloudbridgeuy/puper/pkg/pipeline"
+	"github.com/cloudbridgeuy/puper/pkg/text"
+)
+
+// FileName is the name of the config file looked up by Discover.
+const FileName = ".puper.yaml"
+
+// Config mirrors the keys supported by the `.puper.yaml` file. Keys named
+// after a flag act as the default value for that flag.
+type Config struct {
+	Charset          string            `yaml:"charset"`
+	Browser          string            `yaml:"browser"`
+	Engine           string            `yaml:"engine"`
+	NoBrowser        bool              `yaml:"no-browser"`
+	Daemon           string            `yaml:"daemon"`
+	FirefoxBinary    string            `yaml:"firefox-binary"`
+	Geckodriver      string            `yaml:"geckodriver-binary"`
+	GeckodriverArg   []string          `yaml:"geckodriver-arg"`
+	ChromeBinary     string            `yaml:"chrome-binary"`
+	BrowserMemory    string            `yaml:"browser-memory-limit"`
+	BrowserNice      int               `yaml:"browser-nice"`
+	Wait             int               `yaml:"wait"`
+	WaitUntil        string            `yaml:"wait-until"`
+	WaitFor          []string          `yaml:"wait-for"`
+	WaitTimeout      string            `yaml:"wait-timeout"`
+	Poll             string            `yaml:"poll"`
+	Click            []string          `yaml:"click"`
+	ClickDelay       string            `yaml:"click-delay"`
+	Scroll           bool              `yaml:"scroll"`
+	ScrollTimes      int               `yaml:"scroll-times"`
+	ScrollPause      string            `yaml:"scroll-pause"`
+	Timeout          string            `yaml:"timeout"`
+	Port             int               `yaml:"port"`
+	Bind             string            `yaml:"bind"`
+	WebdriverURL     string            `yaml:"webdriver-url"`
+	Attach           string            `yaml:"attach"`
+	StartupTimeout   string            `yaml:"startup-timeout"`
+	Header           []string          `yaml:"header"`
+	UserAgent        string            `yaml:"user-agent"`
+	Lang             []string          `yaml:"lang"`
+	Viewport         string            `yaml:"viewport"`
+	Device           string            `yaml:"device"`
+	ExecJS           []string          `yaml:"exec-js"`
+	ExecJSFile       []string          `yaml:"exec-js-file"`
+	LoginScript      string            `yaml:"login-script"`
+	Auth             string            `yaml:"auth"`
+	Bearer           string            `yaml:"bearer"`
+	Cookies          string            `yaml:"cookies"`
+	AWSSigV4         string            `yaml:"aws-sigv4"`
+	Impersonate      string            `yaml:"impersonate"`
+	SaveCookies      bool              `yaml:"save-cookies"`
+	Selector         []string          `yaml:"selector"`
+	OnNoMatch        []string          `yaml:"on-no-match"`
+	SectionMatching  string            `yaml:"section-matching"`
+	Outline          string            `yaml:"outline"`
+	Media            string            `yaml:"media"`
+	DownloadOGImage  string            `yaml:"download-og-image"`
+	Favicon          bool              `yaml:"favicon"`
+	Manifest         string            `yaml:"manifest"`
+	FaviconDir       string            `yaml:"favicon-dir"`
+	RemoveAttributes bool              `yaml:"remove-attributes"`
+	RemoveSpan       bool              `yaml:"remove-span"`
+	Ruby             string            `yaml:"ruby"`
+	BidiMarks        bool              `yaml:"bidi-marks"`
+	AutoRoute        bool              `yaml:"auto-route"`
+	PDF              string            `yaml:"pdf"`
+	Markdown         bool              `yaml:"markdown"`
+	Text             bool              `yaml:"text"`
+	MDFigures        string            `yaml:"md-figures"`
+	MDDetails        string            `yaml:"md-details"`
+	MDAnchors        string            `yaml:"md-anchors"`
+	Cite             string            `yaml:"cite"`
+	PDFLayout        bool              `yaml:"pdf-layout"`
+	NormalizeUnicode string            `yaml:"normalize-unicode"`
+	ReplaceNbsp      bool              `yaml:"replace-nbsp"`
+	AsciiPunctuation bool              `yaml:"ascii-punctuation"`
+	NormalizeDates   bool              `yaml:"normalize-dates"`
+	Redact           []string          `yaml:"redact"`
+	RedactPatterns   map[string]string `yaml:"redact-patterns"`
+	Transform        []string          `yaml:"transform"`
+	FilterCmd        []string          `yaml:"filter-cmd"`
+	Transcripts      bool              `yaml:"transcripts"`
+	TranscriptLang   string            `yaml:"transcript-lang"`
+	Script           string            `yaml:"script"`
+	Mode             string            `yaml:"mode"`
+	Verbose          bool              `yaml:"verbose"`
+	ConsoleLog       bool              `yaml:"console-log"`
+	FailOnJSError    string            `yaml:"fail-on-js-error"`
+	Perf             bool              `yaml:"perf"`
+	Proxy            string            `yaml:"proxy"`
+	Tor              bool              `yaml:"tor"`
+	TorProxy         string            `yaml:"tor-proxy"`
+	TorControl       string            `yaml:"tor-control"`
+	TorPassword      string            `yaml:"tor-control-password"`
+}
+
+// Keys returns the top level keys supported by the config file.
+func Keys() []string {
+	keys := []string{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// Discover returns the config files that apply to the given directory, from
+// the lowest to the highest precedence: the one in the home directory first,
+// then the ones found walking from the filesystem root down to dir.
+func Discover(home, dir string) []string {
+	files := []string{}
+	seen := map[string]bool{}
+
+	add := func(path string) {
+		if seen[path] {
+			return
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+			seen[path] = true
+		}
+	}
+
+	if home != "" {
+		add(filepath.Join(home, FileName))
+	}
+
+	ancestors := []string{}
+	for dir != "" {
+		ancestors = append(ancestors, filepath.Join(dir, FileName))
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		add(ancestors[i])
+	}
+
+	return files
+}
+
+// Problem is an issue found while validating a config file.
+type Problem struct {
+	Line    int
+	Message string
+}
+
+// String returns the problem prefixed with its line number, if known.
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+var typeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// expandedKeys are the keys taking secrets, URLs and paths, the only ones
+// whose `${NAME}` references get expanded. Scripts, selectors and patterns
+// keep theirs as they are, like the template literals of exec-js.
+var expandedKeys = map[string]bool{
+	"daemon": true, "firefox-binary": true, "geckodriver-binary": true,
+	"geckodriver-arg": true, "chrome-binary": true, "webdriver-url": true,
+	"attach": true, "header": true, "user-agent": true, "exec-js-file": true,
+	"login-script": true, "auth": true, "bearer": true, "cookies": true,
+	"download-og-image": true, "manifest": true, "favicon-dir": true,
+	"script": true, "proxy": true, "tor-proxy": true, "tor-control": true,
+	"tor-control-password": true,
+}
+
+// Expands tells whether the `${NAME}` references of the values of the key
+// get expanded.
+func Expands(key string) bool {
+	return expandedKeys[key]
+}
+
+var envReference = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Expand replaces the `${NAME}` references in a config value with the value
+// of the environment variable. `${NAME:-default}` falls back to the default
+// when the variable is unset or empty, and `$${` escapes a literal `${`. A
+// reference to an unset variable without a default is an error. Only the
+// values of the keys Expands reports get expanded.
+func Expand(value string) (string, error) {
+	missing := []string{}
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		if reference == "$${" {
+			return "${"
+		}
+
+		match := envReference.FindStringSubmatch(reference)
+		name, hasDefault, fallback := match[1], match[2] != "", match[3]
+
+		env, ok := os.LookupEnv(name)
+		switch {
+		case hasDefault && env == "":
+			return fallback
+		case !ok:
+			missing = append(missing, name)
+		}
+		return env
+	})
+
+	if len(missing) > 0 {
+		return value, fmt.Errorf("missing environment variable: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// Load strictly decodes the config file found at path. Unknown keys and type
+// mismatches are returned as problems alongside the decoded config.
+func Load(path string) (Config, []Problem, error) {
+	var c Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	problems := []Problem{}
+	err = decoder.Decode(&c)
+
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+	case errors.As(err, &typeErr):
+		for _, e := range typeErr.Errors {
+			problems = append(problems, newProblem(e))
+		}
+	default:
+		return c, []Problem{newProblem(err.Error())}, nil
+	}
+
+	return c, problems, nil
+}
+
+// Validate loads the config file found at path and checks the values that
+// can't be validated by their type alone, like selectors and patterns.
+func Validate(path string) ([]Problem, error) {
+	c, problems, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil || len(document.Content) == 0 {
+		return problems, nil
+	}
+	root := document.Content[0]
+
+	for i := 0; root.Kind == yaml.MappingNode && i+1 < len(root.Content); i += 2 {
+		if !Expands(root.Content[i].Value) {
+			continue
+		}
+		for _, scalar := range scalars(root.Content[i+1]) {
+			if _, err := Expand(scalar.Value); err != nil {
+				problems = append(problems, Problem{scalar.Line, err.Error()})
+			}
+		}
+	}
+
+	for _, item := range sequence(root, "selector") {
+		if err := html.ValidateSelector(item.Value); err != nil {
+			problems = append(problems, Problem{item.Line, fmt.Sprintf("invalid selector %q: %s", item.Value, err)})
+		}
+	}
+
+	for _, item := range sequence(root, "on-no-match") {
+		if _, err := pipeline.ParseNoMatchPolicy([]string{item.Value}); err != nil {
+			problems = append(problems, Problem{item.Line, err.Error()})
+		}
+	}
+
+	if key, value := lookup(root, "browser"); value != nil {
+		switch c.Browser {
+		case "firefox", "chrome":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported browser: %s", c.Browser)})
+		}
+	}
+
+	if key, value := lookup(root, "engine"); value != nil {
+		switch c.Engine {
+		case "webdriver", "cdp":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported engine: %s", c.Engine)})
+		}
+	}
+
+	if _, value := lookup(root, "browser-memory-limit"); value != nil && c.BrowserMemory != "" {
+		if _, err := browser.ParseSize(c.BrowserMemory); err != nil {
+			problems = append(problems, Problem{value.Line, err.Error()})
+		}
+	}
+
+	if _, value := lookup(root, "browser-nice"); value != nil && (c.BrowserNice < -20 || c.BrowserNice > 19) {
+		problems = append(problems, Problem{value.Line, fmt.Sprintf("invalid browser-nice: expected a value from -20 to 19, got %d", c.BrowserNice)})
+	}
+
+	if key, value := lookup(root, "impersonate"); value != nil {
+		switch c.Impersonate {
+		case "chrome", "firefox", "safari":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported browser to impersonate: %s", c.Impersonate)})
+		}
+	}
+
+	if key, value := lookup(root, "ruby"); value != nil {
+		switch c.Ruby {
+		case "keep", "inline", "strip":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported ruby mode: %s", c.Ruby)})
+		}
+	}
+
+	if key, value := lookup(root, "md-figures"); value != nil {
+		switch c.MDFigures {
+		case "caption", "admonition":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported figure mode: %s", c.MDFigures)})
+		}
+	}
+
+	if key, value := lookup(root, "md-details"); value != nil {
+		switch c.MDDetails {
+		case "expand", "keep", "drop":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported details mode: %s", c.MDDetails)})
+		}
+	}
+
+	if key, value := lookup(root, "md-anchors"); value != nil {
+		switch c.MDAnchors {
+		case "none", "pandoc", "gfm":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported anchor mode: %s", c.MDAnchors)})
+		}
+	}
+
+	if key, value := lookup(root, "cite"); value != nil {
+		switch c.Cite {
+		case "none", "document", "section":
+		default:
+			problems = append(problems, Problem{key.Line, fmt.Sprintf("unsupported cite mode: %s", c.Cite)})
+		}
+	}
+
+	if key, value := lookup(root, "mode"); value != nil {
+		if _, err := output.ParseMode(c.Mode); err != nil {
+			problems = append(problems, Problem{key.Line, err.Error()})
+		}
+	}
+
+	if _, value := lookup(root, "timeout"); value != nil {
+		if _, err := time.ParseDuration(value.Value); err != nil {
+			problems = append(problems, Problem{value.Line, fmt.Sprintf("invalid timeout: %s", err)})
+		}
+	}
+
+	if _, value := lookup(root, "wait-until"); value != nil && c.WaitUntil != "" {
+		if _, err := browser.ParseWaitUntil(c.WaitUntil); err != nil {
+			problems = append(problems, Problem{value.Line, err.Error()})
+		}
+	}
+
+	for _, item := range sequence(root, "wait-for") {
+		if err := html.ValidateSelector(item.Value); err != nil {
+			problems = append(problems, Problem{item.Line, fmt.Sprintf("invalid wait-for selector %q: %s", item.Value, err)})
+		}
+	}
+
+	for _, item := range sequence(root, "click") {
+		if err := html.ValidateSelector(item.Value); err != nil {
+			problems = append(problems, Problem{item.Line, fmt.Sprintf("invalid click selector %q: %s", item.Value, err)})
+		}
+	}
+
+	for _, key := range []string{"wait-timeout", "poll", "scroll-pause", "click-delay"} {
+		if _, value := lookup(root, key); value != nil {
+			if _, err := time.ParseDuration(value.Value); err != nil {
+				problems = append(problems, Problem{value.Line, fmt.Sprintf("invalid %s: %s", key, err)})
+			}
+		}
+	}
+
+	if _, value := lookup(root, "startup-timeout"); value != nil {
+		if _, err := time.ParseDuration(value.Value); err != nil {
+			problems = append(problems, Problem{value.Line, fmt.Sprintf("invalid startup-timeout: %s", err)})
+		}
+	}
+
+	if key, value := lookup(root, "normalize-unicode"); value != nil && c.NormalizeUnicode != "" {
+		if _, err := text.Normalize(c.NormalizeUnicode); err != nil {
+			problems = append(problems, Problem{key.Line, err.Error()})
+		}
+	}
+
+	if _, value := lookup(root, "section-matching"); value != nil {
+		if _, err := regexp.Compile(value.Value); err != nil {
+			problems = append(problems, Problem{value.Line, fmt.Sprintf("invalid section-matching pattern: %s", err)})
+		}
+	}
+
+	if _, value := lookup(root, "fail-on-js-error"); value != nil {
+		if _, err := regexp.Compile(value.Value); err != nil {
+			problems = append(problems, Problem{value.Line, fmt.Sprintf("invalid fail-on-js-error pattern: %s", err)})
+		}
+	}
+
+	if _, value := lookup(root, "redact-patterns"); value != nil && value.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			name, pattern := value.Content[i], value.Content[i+1]
+			if _, err := regexp.Compile(pattern.Value); err != nil {
+				problems = append(problems, Problem{pattern.Line, fmt.Sprintf("invalid redaction pattern %s: %s", name.Value, err)})
+			}
+		}
+	}
+
+	for _, item := range sequence(root, "redact") {
+		_, custom := c.RedactPatterns[item.Value]
+		_, builtin := text.RedactPatterns[item.Value]
+		if !custom && !builtin {
+			problems = append(problems, Problem{item.Line, fmt.Sprintf("unknown redaction pattern: %s", item.Value)})
+		}
+	}
+
+	return problems, nil
+}
+
+// newProblem splits the `line N:` prefix used by the yaml package errors.
+func newProblem(message string) Problem {
+	match := typeErrorLine.FindStringSubmatch(message)
+	if match == nil {
+		return Problem{Message: message}
+	}
+	line, _ := strconv.Atoi(match[1])
+	return Problem{line, match[2]}
+}
+
+// lookup returns the key and value nodes of a top level mapping entry.
+func lookup(root *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if root.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			return root.Content[i], root.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// sequence returns the items of a top level sequence entry.
+func sequence(root *yaml.Node, key string) []*yaml.Node {
+	_, value := lookup(root, key)
+	if value == nil || value.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return value.Content
+}
+
+// scalars returns every scalar value of the document.
+func scalars(node *yaml.Node) []*yaml.Node {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []*yaml.Node{node}
+	case yaml.MappingNode:
+		values := []*yaml.Node{}
+		for i := 1; i < len(node.Content); i += 2 {
+			values = append(values, scalars(node.Content[i])...)
+		}
+		return values
+	default:
+		values := []*yaml.Node{}
+		for _, child := range node.Content {
+			values = append(values, scalars(child)...)
+		}
+		return values
+	}
+}
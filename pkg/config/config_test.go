@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	t.Setenv("PUPER_TEST_TOKEN", "s3cret")
+	t.Setenv("PUPER_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "no reference", in: "plain value", want: "plain value"},
+		{name: "variable", in: "Bearer ${PUPER_TEST_TOKEN}", want: "Bearer s3cret"},
+		{name: "several", in: "${PUPER_TEST_TOKEN}:${PUPER_TEST_TOKEN}", want: "s3cret:s3cret"},
+		{name: "empty variable", in: "[${PUPER_TEST_EMPTY}]", want: "[]"},
+		{name: "default unused", in: "${PUPER_TEST_TOKEN:-other}", want: "s3cret"},
+		{name: "default when unset", in: "${PUPER_TEST_UNSET:-http://localhost:8080}", want: "http://localhost:8080"},
+		{name: "default when empty", in: "${PUPER_TEST_EMPTY:-fallback}", want: "fallback"},
+		{name: "empty default", in: "[${PUPER_TEST_UNSET:-}]", want: "[]"},
+		{name: "escaped", in: "$${PUPER_TEST_TOKEN}", want: "${PUPER_TEST_TOKEN}"},
+		{name: "escaped and expanded", in: "$${x} ${PUPER_TEST_TOKEN}", want: "${x} s3cret"},
+		{name: "lone dollar", in: "$PUPER_TEST_TOKEN costs $5", want: "$PUPER_TEST_TOKEN costs $5"},
+		{name: "invalid name left as is", in: "${1ABC}", want: "${1ABC}"},
+		{name: "unset", in: "${PUPER_TEST_UNSET}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expand(%q) = %q, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand(%q) returned %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+)
+
+type client struct {
+	browser.Options
+	socket   string
+	response Response
+}
+
+// NewClient returns a driver that submits the page to the daemon listening
+// on the socket instead of starting a browser. The browser settings of the
+// options are the ones the daemon was started with.
+func NewClient(socket string, o browser.Options) *client {
+	return &client{Options: o, socket: socket}
+}
+
+// Run asks the daemon to load the page.
+func (c *client) Run(ctx context.Context) error {
+	request := Request{
+		URL:         c.URL,
+		Selectors:   c.Selectors,
+		Wait:        c.Wait,
+		WaitFor:     c.WaitFor,
+		WaitTimeout: c.WaitTimeout,
+		Poll:        c.Poll,
+		Click:       c.Click,
+		ClickDelay:  c.ClickDelay,
+		ScrollTimes: c.ScrollTimes,
+		ScrollPause: c.ScrollPause,
+		Perf:        c.Perf,
+		Username:    c.Username,
+		Password:    c.Password,
+		Scripts:     c.Scripts,
+		Login:       c.Login,
+		Cookies:     c.Cookies,
+		SaveCookies: c.SaveCookies,
+		PrintPDF:    c.PrintPDF,
+	}
+	if c.WaitUntil != nil {
+		request.WaitUntil = c.WaitUntil.String()
+	}
+	if c.Viewport != nil {
+		request.Viewport = fmt.Sprintf("%dx%d", c.Viewport.Width, c.Viewport.Height)
+	}
+	if c.FailOn != nil {
+		request.FailOn = c.FailOn.String()
+	}
+
+	c.Logger.Debug("Submitting the page to the daemon", "socket", c.socket)
+	var err error
+	if c.response, err = send(ctx, c.socket, request); err != nil {
+		return err
+	}
+
+	if c.response.Error != "" {
+		return errors.NewPuperError(fmt.Errorf("%s", c.response.Error), "The daemon failed to load the page")
+	}
+	return nil
+}
+
+// GetConsoleMessages returns the console messages logged while the daemon
+// loaded the page, if it was started with the console log enabled.
+func (c *client) GetConsoleMessages() []browser.ConsoleMessage {
+	return c.response.Console
+}
+
+// GetContentType returns an empty string, the browser of the daemon renders
+// every page as HTML.
+func (c *client) GetContentType() string {
+	return ""
+}
+
+// GetCookies returns the cookies of the daemon session, if they were
+// requested.
+func (c *client) GetCookies() []browser.Cookie {
+	return c.response.Cookies
+}
+
+// GetPDF returns the page printed by the daemon, if it was requested.
+func (c *client) GetPDF() []byte {
+	return c.response.PDF
+}
+
+// GetPerfMetrics returns the navigation timing captured by the daemon, or nil
+// if it wasn't requested or available.
+func (c *client) GetPerfMetrics() *browser.PerfMetrics {
+	return c.response.Metrics
+}
+
+// GetSource returns the source the daemon captured.
+func (c *client) GetSource() string {
+	return c.response.Source
+}
+
+// GetURL returns the URL of the page after following redirects, or the
+// requested one if it wasn't fetched yet.
+func (c *client) GetURL() string {
+	if c.response.URL == "" {
+		return c.URL
+	}
+	return c.response.URL
+}
@@ -0,0 +1,278 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/geckodriver"
+)
+
+// Request asks the daemon to load a page, or to stop.
+type Request struct {
+	Stop      bool     `json:"stop,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Selectors []string `json:"selectors,omitempty"`
+	Wait      int      `json:"wait,omitempty"`
+	WaitUntil string   `json:"waitUntil,omitempty"`
+	WaitFor   []string `json:"waitFor,omitempty"`
+	// WaitTimeout and Poll are nanoseconds.
+	WaitTimeout time.Duration `json:"waitTimeout,omitempty"`
+	Poll        time.Duration `json:"poll,omitempty"`
+	Click       []string      `json:"click,omitempty"`
+	ClickDelay  time.Duration `json:"clickDelay,omitempty"`
+	ScrollTimes int           `json:"scrollTimes,omitempty"`
+	ScrollPause time.Duration `json:"scrollPause,omitempty"`
+	Perf        bool          `json:"perf,omitempty"`
+	FailOn      string        `json:"failOn,omitempty"`
+	// Username and Password are the HTTP basic authentication credentials.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Scripts are run in the page before capturing its source.
+	Scripts []string `json:"scripts,omitempty"`
+	// Login is run before loading the page.
+	Login *browser.LoginScript `json:"login,omitempty"`
+	// Cookies are added to the session before loading the page.
+	Cookies     []browser.Cookie `json:"cookies,omitempty"`
+	SaveCookies bool             `json:"saveCookies,omitempty"`
+	PrintPDF    bool             `json:"printPDF,omitempty"`
+	// Viewport is the size the page is rendered at, like 1280x800.
+	Viewport string `json:"viewport,omitempty"`
+}
+
+// Response is what the daemon answers to a request.
+type Response struct {
+	Source  string                   `json:"source,omitempty"`
+	URL     string                   `json:"url,omitempty"`
+	Console []browser.ConsoleMessage `json:"console,omitempty"`
+	Metrics *browser.PerfMetrics     `json:"metrics,omitempty"`
+	Cookies []browser.Cookie         `json:"cookies,omitempty"`
+	PDF     []byte                   `json:"pdf,omitempty"`
+	Error   string                   `json:"error,omitempty"`
+}
+
+// DefaultSocket returns the path of the socket the daemon listens on when
+// none is given: `puper.sock` in the runtime directory of the user, or a
+// per-user file in the temporary directory.
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "puper.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("puper-%d.sock", os.Getuid()))
+}
+
+// Serve starts a warm geckodriver session and loads the pages requested
+// through the unix socket until a stop request comes or the context is
+// cancelled. Requests are served one at a time since they share the browser,
+// which is restarted when it dies. The browser settings are the ones of the
+// options, requests only carry page settings.
+func Serve(ctx context.Context, socket string, o browser.Options) error {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return errors.NewPuperError(fmt.Errorf("%s is in use", socket), "A daemon is already running")
+	}
+	os.Remove(socket)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	o.Logger.Debug("Starting the browser session")
+	session, err := geckodriver.Open(ctx, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if session != nil {
+			session.Close()
+		}
+	}()
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return errors.NewPuperError(err, "Can't listen on the socket")
+	}
+	defer os.Remove(socket)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	o.Logger.Info("Daemon listening", "socket", socket)
+
+	var mu sync.Mutex
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.NewPuperError(err, "Can't accept connections")
+		}
+
+		go func() {
+			defer conn.Close()
+
+			var request Request
+			if err := json.NewDecoder(conn).Decode(&request); err != nil {
+				o.Logger.Warn("Invalid request", "err", err)
+				return
+			}
+
+			if request.Stop {
+				o.Logger.Info("Stopping the daemon")
+				json.NewEncoder(conn).Encode(Response{})
+				cancel()
+				return
+			}
+
+			mu.Lock()
+			response := serve(ctx, &session, o, request)
+			mu.Unlock()
+
+			if err := json.NewEncoder(conn).Encode(response); err != nil {
+				o.Logger.Warn("Can't send the response", "err", err)
+			}
+		}()
+	}
+}
+
+// serve loads the requested page in the session, starting a new one if the
+// browser died. The page is reset afterwards so the next request doesn't
+// get its cookies and storage, and the session is closed if that fails.
+func serve(ctx context.Context, session **geckodriver.Session, o browser.Options, request Request) Response {
+	if *session != nil && !(*session).Alive() {
+		o.Logger.Warn("The browser session is gone")
+		(*session).Close()
+		*session = nil
+	}
+	if *session == nil {
+		o.Logger.Info("Restarting the browser session")
+		s, err := geckodriver.Open(ctx, o)
+		if err != nil {
+			return Response{Error: fmt.Sprintf("can't restart the browser: %s", err)}
+		}
+		*session = s
+	}
+
+	response := load(ctx, *session, o.Logger, request)
+
+	if err := (*session).Reset(); err != nil {
+		o.Logger.Warn("The browser session is gone, it will be restarted", "err", err)
+		(*session).Close()
+		*session = nil
+	}
+	return response
+}
+
+// load loads the requested page in the session.
+func load(ctx context.Context, session *geckodriver.Session, logger *log.Logger, request Request) Response {
+	logger.Info("Loading", "url", request.URL)
+
+	builder := browser.NewBuilder().
+		WithLogger(logger).
+		WithUrl(request.URL).
+		WithSelectors(request.Selectors).
+		WithWait(request.Wait).
+		WithWaitFor(request.WaitFor).
+		WithClick(request.Click, request.ClickDelay).
+		WithScroll(request.ScrollTimes, request.ScrollPause).
+		WithPerf(request.Perf).
+		WithBasicAuth(request.Username, request.Password).
+		WithScripts(request.Scripts).
+		WithLogin(request.Login).
+		WithCookies(request.Cookies).
+		WithSaveCookies(request.SaveCookies).
+		WithPrintPDF(request.PrintPDF)
+
+	if request.WaitTimeout > 0 {
+		builder.WithWaitTimeout(request.WaitTimeout)
+	}
+	if request.Poll > 0 {
+		builder.WithPoll(request.Poll)
+	}
+
+	if request.WaitUntil != "" {
+		until, err := browser.ParseWaitUntil(request.WaitUntil)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		builder.WithWaitUntil(until)
+	}
+
+	if request.Viewport != "" {
+		viewport, err := browser.ParseViewport(request.Viewport)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		builder.WithViewport(&viewport)
+	}
+
+	if request.FailOn != "" {
+		pattern, err := regexp.Compile(request.FailOn)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		builder.WithFailOnError(pattern)
+	}
+
+	capture, console, err := session.Load(ctx, builder.Build())
+	response := Response{
+		Source:  capture.Source,
+		URL:     capture.URL,
+		Console: console,
+		Metrics: capture.Metrics,
+		Cookies: capture.Cookies,
+		PDF:     capture.PDF,
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	return response
+}
+
+// send sends a request to the daemon listening on the socket and returns its
+// response.
+func send(ctx context.Context, socket string, request Request) (Response, error) {
+	var response Response
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	if err != nil {
+		return response, errors.NewPuperError(err, "Can't reach the daemon, is it running?")
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return response, errors.NewPuperError(err, "Can't send the request to the daemon")
+	}
+
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		if ctx.Err() != nil {
+			return response, errors.NewPuperError(ctx.Err(), "Interrupted while waiting for the daemon")
+		}
+		return response, errors.NewPuperError(err, "Can't read the daemon response")
+	}
+
+	return response, nil
+}
+
+// Stop asks the daemon listening on the socket to stop.
+func Stop(ctx context.Context, socket string) error {
+	_, err := send(ctx, socket, Request{Stop: true})
+	return err
+}
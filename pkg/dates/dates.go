@@ -0,0 +1,163 @@
+package dates
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// dateLayouts are the date only formats Parse understands, tried in order.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"20060102",
+	"January 2, 2006",
+	"January 2 2006",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"Jan. 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"02 Jan 2006",
+	"Monday, January 2, 2006",
+	"Mon, January 2, 2006",
+	"Monday, 2 January 2006",
+	"Mon, 2 Jan 2006",
+	"January 2006",
+}
+
+// timeLayouts are the date and time formats Parse understands, tried in order.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.ANSIC,
+	time.UnixDate,
+	"January 2, 2006 3:04 PM",
+	"January 2, 2006 at 3:04 PM",
+	"Jan 2, 2006 3:04 PM",
+	"Jan 2, 2006 at 3:04 PM",
+	"2 January 2006 15:04",
+}
+
+var ordinalSuffix = regexp.MustCompile(`\b(\d{1,2})(st|nd|rd|th)\b`)
+
+// Parse parses a human date in one of the common formats and returns the
+// layout that matched it.
+func Parse(s string) (time.Time, string, bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	s = ordinalSuffix.ReplaceAllString(s, "$1")
+
+	for _, layout := range append(timeLayouts, dateLayouts...) {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, layout, true
+		}
+	}
+
+	return time.Time{}, "", false
+}
+
+// Normalize returns the ISO 8601 form of a human date: `2006-01-02` for dates,
+// `2006-01-02T15:04:05` for local times and RFC 3339 for times with a zone.
+func Normalize(s string) (string, bool) {
+	t, layout, ok := Parse(s)
+	switch {
+	case !ok:
+		return s, false
+	case !strings.Contains(layout, "15") && !strings.Contains(layout, "3:04"):
+		return t.Format("2006-01-02"), true
+	case strings.Contains(layout, "Z07") || strings.Contains(layout, "-0700") || strings.Contains(layout, "MST"):
+		return t.Format(time.RFC3339), true
+	default:
+		return t.Format("2006-01-02T15:04:05"), true
+	}
+}
+
+// NormalizeNodes rewrites the `<time>` elements found in the nodes so both
+// their `datetime` attribute and their text hold the ISO 8601 date. The date
+// is read from the attribute, falling back to the text.
+func NormalizeNodes(nodes []*html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Time {
+			normalizeTime(n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	for _, n := range nodes {
+		walk(n)
+	}
+}
+
+// NormalizeMetadata rewrites, in place, the metadata values whose key names
+// a date or a time, like `article:published_time`.
+func NormalizeMetadata(metadata map[string]string) {
+	for key, value := range metadata {
+		lower := strings.ToLower(key)
+		if !strings.Contains(lower, "date") && !strings.Contains(lower, "time") {
+			continue
+		}
+		if normalized, ok := Normalize(value); ok {
+			metadata[key] = normalized
+		}
+	}
+}
+
+func normalizeTime(n *html.Node) {
+	index := -1
+	for i, a := range n.Attr {
+		if a.Key == "datetime" {
+			index = i
+		}
+	}
+
+	normalized, ok := "", false
+	if index >= 0 {
+		normalized, ok = Normalize(n.Attr[index].Val)
+	}
+	if !ok {
+		normalized, ok = Normalize(text(n))
+	}
+	if !ok {
+		return
+	}
+
+	if index >= 0 {
+		n.Attr[index].Val = normalized
+	} else {
+		n.Attr = append(n.Attr, html.Attribute{Key: "datetime", Val: normalized})
+	}
+
+	for n.FirstChild != nil {
+		n.RemoveChild(n.FirstChild)
+	}
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: normalized})
+}
+
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(text(c))
+	}
+	return b.String()
+}
@@ -1,23 +1,54 @@
 package display
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
+	"github.com/cloudbridgeuy/puper/pkg/text"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
 
+// RubyMode controls how `<ruby>` annotations are rendered.
+type RubyMode string
+
+const (
+	// RubyKeep prints `<ruby>` elements like any other element.
+	RubyKeep RubyMode = "keep"
+	// RubyInline prints the base text followed by the reading in parentheses.
+	RubyInline RubyMode = "inline"
+	// RubyStrip prints the base text only.
+	RubyStrip RubyMode = "strip"
+)
+
+// Unicode directional isolates used to wrap right-to-left text.
+const (
+	rightToLeftIsolate    = "\u2067"
+	popDirectionalIsolate = "\u2069"
+)
+
 type DisplayBuilder struct {
 	inner *display
 }
 
 func NewDisplayBuilder() *DisplayBuilder {
 	return &DisplayBuilder{
-		inner: &display{},
+		inner: &display{
+			writer: os.Stdout,
+			ruby:   RubyKeep,
+		},
 	}
 }
 
+// WithWriter sets where the nodes get printed. Defaults to stdout.
+func (b *DisplayBuilder) WithWriter(value io.Writer) *DisplayBuilder {
+	b.inner.writer = value
+	return b
+}
+
 func (b *DisplayBuilder) WithAttributes(value bool) *DisplayBuilder {
 	b.inner.attributes = value
 	return b
@@ -28,30 +59,65 @@ func (b *DisplayBuilder) WithSpan(value bool) *DisplayBuilder {
 	return b
 }
 
+func (b *DisplayBuilder) WithRuby(value RubyMode) *DisplayBuilder {
+	b.inner.ruby = value
+	return b
+}
+
+func (b *DisplayBuilder) WithBidiMarks(value bool) *DisplayBuilder {
+	b.inner.bidiMarks = value
+	return b
+}
+
+// WithTextFilter adds a filter applied, in order, to every piece of text.
+func (b *DisplayBuilder) WithTextFilter(filter text.Filter) *DisplayBuilder {
+	b.inner.filters = append(b.inner.filters, filter)
+	return b
+}
+
+// WithAttributeFilter adds a filter applied, in order, to every printed
+// attribute value.
+func (b *DisplayBuilder) WithAttributeFilter(filter text.Filter) *DisplayBuilder {
+	b.inner.attributeFilters = append(b.inner.attributeFilters, filter)
+	return b
+}
+
 func (b *DisplayBuilder) Build() *display {
 	return b.inner
 }
 
 type display struct {
+	writer     io.Writer
 	attributes bool
 	span       bool
+	ruby       RubyMode
+	bidiMarks  bool
+	filters    []text.Filter
+
+	attributeFilters []text.Filter
 }
 
-func (d display) Print(nodes []*html.Node) {
+// Print prints the nodes, stopping with the context error once the context
+// is done.
+func (d display) Print(ctx context.Context, nodes []*html.Node) error {
 	for _, node := range nodes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		d.PrintNode(node, 0)
 	}
+	return nil
 }
 
 // PrintNode prints the node and its children.
 func (d display) PrintNode(n *html.Node, level int) {
 	switch n.Type {
 	case html.TextNode:
-		s := n.Data
+		s := d.Text(text.JoinCJK(n.Data))
 		s = strings.TrimSpace(s)
 		if s != "" {
 			d.PrintIndent(level)
-			fmt.Println(s)
+			fmt.Fprintln(d.writer, d.isolate(n, s))
 		}
 	case html.ElementNode:
 		d.PrintIndent(level)
@@ -63,25 +129,28 @@ func (d display) PrintNode(n *html.Node, level int) {
 			d.PrintChildren(n, level)
 			return
 		}
-		fmt.Printf("<%s", n.Data)
+		if n.DataAtom == atom.Ruby && d.ruby != RubyKeep {
+			fmt.Fprintln(d.writer, d.isolate(n, d.Text(d.RubyText(n))))
+			return
+		}
+		fmt.Fprintf(d.writer, "<%s", n.Data)
 		for _, a := range n.Attr {
-			if !d.attributes && a.Key != "href" && a.Key != "id" {
+			if !d.keepAttribute(a.Key) {
 				continue
 			}
-			val := a.Val
-			fmt.Printf(` %s="%s"`, a.Key, val)
+			val := d.Attribute(a.Val)
+			fmt.Fprintf(d.writer, ` %s="%s"`, a.Key, val)
 		}
-		fmt.Println(">")
+		fmt.Fprintln(d.writer, ">")
 
 		if !IsVoidElement(n) {
 			d.PrintChildren(n, level+1)
 			d.PrintIndent(level)
-			fmt.Printf("</%s>\n", n.Data)
+			fmt.Fprintf(d.writer, "</%s>\n", n.Data)
 		}
 	case html.CommentNode:
 		d.PrintIndent(level)
-		data := n.Data
-		fmt.Printf("<!--%s-->\n", data)
+		fmt.Fprintf(d.writer, "<!--%s-->\n", d.Text(n.Data))
 		d.PrintChildren(n, level)
 	case html.DoctypeNode, html.DocumentNode:
 		d.PrintChildren(n, level)
@@ -92,14 +161,92 @@ func (d display) PrintNode(n *html.Node, level int) {
 func (d display) PrintChildren(n *html.Node, level int) {
 	child := n.FirstChild
 	for child != nil {
+		if d.ruby != RubyKeep && d.isTextRun(child) {
+			// Join text and flattened ruby siblings on a single line so CJK
+			// sentences don't get broken around their annotations.
+			var b strings.Builder
+			for ; child != nil && d.isTextRun(child); child = child.NextSibling {
+				if child.Type == html.TextNode {
+					b.WriteString(child.Data)
+				} else {
+					b.WriteString(d.RubyText(child))
+				}
+			}
+			if s := strings.TrimSpace(d.Text(text.JoinCJK(b.String()))); s != "" {
+				d.PrintIndent(level)
+				fmt.Fprintln(d.writer, d.isolate(n, s))
+			}
+			continue
+		}
 		d.PrintNode(child, level)
 		child = child.NextSibling
 	}
 }
 
+// Text runs the text filters over the string.
+func (d display) Text(s string) string {
+	for _, filter := range d.filters {
+		s = filter(s)
+	}
+	return s
+}
+
+// Attribute runs the attribute filters over the value.
+func (d display) Attribute(s string) string {
+	for _, filter := range d.attributeFilters {
+		s = filter(s)
+	}
+	return s
+}
+
+// keepAttribute reports whether the attribute should be printed. Links, ids
+// and the text direction survive even when attributes are removed.
+func (d display) keepAttribute(key string) bool {
+	if d.attributes {
+		return true
+	}
+	switch key {
+	case "href", "id", "dir":
+		return true
+	}
+	return false
+}
+
+// isolate wraps the text in Unicode directional isolates when it sits inside
+// a right-to-left context, so it renders correctly once the surrounding
+// markup is gone. The indentation stays outside of the isolate.
+func (d display) isolate(n *html.Node, s string) string {
+	if !d.bidiMarks || Direction(n) != "rtl" {
+		return s
+	}
+	return rightToLeftIsolate + s + popDirectionalIsolate
+}
+
+// Direction returns the value of the closest `dir` attribute found on the node
+// or its ancestors, or an empty string if there is none.
+func Direction(n *html.Node) string {
+	for ; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for _, a := range n.Attr {
+			if a.Key == "dir" {
+				return strings.ToLower(a.Val)
+			}
+		}
+	}
+	return ""
+}
+
+// isTextRun reports whether the node can be printed inline with its text
+// siblings.
+func (d display) isTextRun(n *html.Node) bool {
+	return n.Type == html.TextNode || (n.Type == html.ElementNode && n.DataAtom == atom.Ruby)
+}
+
 func (d display) PrintIndent(level int) {
 	for ; level > 0; level-- {
-		fmt.Print(" ")
+		fmt.Fprint(d.writer, " ")
 	}
 }
 
@@ -107,8 +254,8 @@ func (d display) PrintIndent(level int) {
 func (d display) PrintPre(n *html.Node) {
 	switch n.Type {
 	case html.TextNode:
-		s := n.Data
-		fmt.Print(s)
+		s := d.Text(n.Data)
+		fmt.Fprint(d.writer, s)
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			d.PrintPre(c)
 		}
@@ -121,26 +268,29 @@ func (d display) PrintPre(n *html.Node) {
 			}
 			return
 		}
-		fmt.Printf("<%s", n.Data)
+		if n.DataAtom == atom.Ruby && d.ruby != RubyKeep {
+			fmt.Fprint(d.writer, d.Text(d.RubyText(n)))
+			return
+		}
+		fmt.Fprintf(d.writer, "<%s", n.Data)
 		if d.attributes {
 			for _, a := range n.Attr {
 				if !d.attributes && a.Key != "href" && a.Key != "id" {
 					continue
 				}
-				val := a.Val
-				fmt.Printf(` %s="%s"`, a.Key, val)
+				val := d.Attribute(a.Val)
+				fmt.Fprintf(d.writer, ` %s="%s"`, a.Key, val)
 			}
 		}
-		fmt.Print(">")
+		fmt.Fprint(d.writer, ">")
 		if !IsVoidElement(n) {
 			for c := n.FirstChild; c != nil; c = c.NextSibling {
 				d.PrintPre(c)
 			}
-			fmt.Printf("</%s>", n.Data)
+			fmt.Fprintf(d.writer, "</%s>", n.Data)
 		}
 	case html.CommentNode:
-		data := n.Data
-		fmt.Printf("<!--%s-->\n", data)
+		fmt.Fprintf(d.writer, "<!--%s-->\n", d.Text(n.Data))
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			d.PrintPre(c)
 		}
@@ -151,6 +301,29 @@ func (d display) PrintPre(n *html.Node) {
 	}
 }
 
+// RubyText flattens a `<ruby>` element into a single run of text so the base
+// characters are never split across lines. The `<rt>` readings are kept in
+// parentheses or dropped depending on the ruby mode, and `<rp>` fallbacks are
+// always dropped.
+func (d display) RubyText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode:
+			b.WriteString(strings.TrimSpace(c.Data))
+		case c.DataAtom == atom.Rp:
+			continue
+		case c.DataAtom == atom.Rt:
+			if d.ruby == RubyInline {
+				b.WriteString("(" + strings.TrimSpace(d.RubyText(c)) + ")")
+			}
+		case c.Type == html.ElementNode:
+			b.WriteString(d.RubyText(c))
+		}
+	}
+	return b.String()
+}
+
 // IsVoidElement returns true if the node is a void element.
 func IsVoidElement(n *html.Node) bool {
 	switch n.DataAtom {
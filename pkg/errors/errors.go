@@ -27,9 +27,17 @@ func HandleError(err error) {
 	var perr PuperError
 
 	if errors.As(err, &perr) {
+		details := perr.Error()
+		if url := perr.URL(); url != "" {
+			details = url + ": " + details
+		}
+		if stage := perr.Stage(); stage != StageUnknown {
+			details = string(stage) + ": " + details
+		}
+
 		args = []interface{}{
 			term.StderrStyles().ErrPadding.Render(term.StderrStyles().ErrorHeader.String(), perr.Reason()),
-			term.StderrStyles().ErrPadding.Render(term.StderrStyles().ErrorDetails.Render(perr.Error())),
+			term.StderrStyles().ErrPadding.Render(term.StderrStyles().ErrorDetails.Render(details)),
 		}
 	} else {
 		args = []interface{}{
@@ -40,15 +48,47 @@ func HandleError(err error) {
 	logger.Logger.Printf(format, args...)
 }
 
+// Stage is the step of the pipeline an error happened in. Stages are errors
+// themselves so callers can branch on them with `errors.Is(err, StageFetch)`.
+type Stage string
+
+const (
+	StageUnknown Stage = ""
+	StageFetch   Stage = "fetch"
+	StageParse   Stage = "parse"
+	StageSelect  Stage = "select"
+	StageConvert Stage = "convert"
+	StageOutput  Stage = "output"
+)
+
+// Error returns the name of the stage.
+func (s Stage) Error() string {
+	return string(s)
+}
+
 // PuperError is a wrapper around an error that adds additional context.
 type PuperError struct {
 	err    error
 	reason string
+	stage  Stage
+	url    string
 }
 
 // NewPuperError creates a new PuperError.
 func NewPuperError(err error, reason string) PuperError {
-	return PuperError{err, reason}
+	return PuperError{err: err, reason: reason}
+}
+
+// WithStage returns a copy of the error tagged with the pipeline stage.
+func (m PuperError) WithStage(stage Stage) PuperError {
+	m.stage = stage
+	return m
+}
+
+// WithURL returns a copy of the error tagged with the URL being processed.
+func (m PuperError) WithURL(url string) PuperError {
+	m.url = url
+	return m
 }
 
 // Error returns the error message.
@@ -60,3 +100,34 @@ func (m PuperError) Error() string {
 func (m PuperError) Reason() string {
 	return m.reason
 }
+
+// Stage returns the pipeline stage of the error, falling back to the one of
+// the wrapped PuperError.
+func (m PuperError) Stage() Stage {
+	var inner PuperError
+	if m.stage == StageUnknown && errors.As(m.err, &inner) {
+		return inner.Stage()
+	}
+	return m.stage
+}
+
+// URL returns the URL being processed when the error happened, falling back
+// to the one of the wrapped PuperError.
+func (m PuperError) URL() string {
+	var inner PuperError
+	if m.url == "" && errors.As(m.err, &inner) {
+		return inner.URL()
+	}
+	return m.url
+}
+
+// Unwrap returns the wrapped error.
+func (m PuperError) Unwrap() error {
+	return m.err
+}
+
+// Is reports whether the error happened in the target stage.
+func (m PuperError) Is(target error) bool {
+	stage, ok := target.(Stage)
+	return ok && stage != StageUnknown && m.Stage() == stage
+}
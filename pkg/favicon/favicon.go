@@ -0,0 +1,174 @@
+package favicon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudbridgeuy/puper/pkg/ogimage"
+	"github.com/cloudbridgeuy/puper/pkg/pipeline"
+)
+
+// Sizes assumed for the icons that don't tell theirs.
+const (
+	vectorSize     = 1024
+	appleTouchSize = 180
+	defaultSize    = 16
+	fallbackSize   = 1
+)
+
+// maxManifestSize is the size of the largest web app manifest read.
+const maxManifestSize = 1 << 20
+
+// Icon is an icon of a site.
+type Icon struct {
+	URL string
+	// Size is the width of the largest size the icon comes in, in pixels.
+	Size int
+}
+
+// Icons returns the icons of the page, the largest first: the ones of its
+// `<link>` elements and of its web app manifest, then `/favicon.ico`. Icons
+// with relative URLs are left out when the page URL is unknown.
+func Icons(ctx context.Context, client *http.Client, pageURL string, links []pipeline.Link) []Icon {
+	base, err := url.Parse(pageURL)
+	if err != nil || !base.IsAbs() {
+		base = nil
+	}
+
+	icons := []Icon{}
+	add := func(base *url.URL, href string, size int) {
+		u, err := url.Parse(href)
+		if err != nil || (base == nil && !u.IsAbs()) {
+			return
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return
+		}
+		icons = append(icons, Icon{URL: u.String(), Size: size})
+	}
+
+	for _, link := range links {
+		rels := strings.Fields(link.Rel)
+		switch {
+		case contains(rels, "icon"):
+			add(base, link.Href, size(link.Sizes, link.Type, link.Href, defaultSize))
+		case contains(rels, "apple-touch-icon") || contains(rels, "apple-touch-icon-precomposed"):
+			add(base, link.Href, size(link.Sizes, link.Type, link.Href, appleTouchSize))
+		case contains(rels, "manifest") && base != nil:
+			manifestURL, err := base.Parse(link.Href)
+			if err != nil {
+				continue
+			}
+			for _, icon := range manifest(ctx, client, manifestURL.String()) {
+				if strings.Contains(icon.Purpose, "monochrome") {
+					continue
+				}
+				add(manifestURL, icon.Src, size(icon.Sizes, icon.Type, icon.Src, defaultSize))
+			}
+		}
+	}
+
+	if base != nil {
+		add(base, "/favicon.ico", fallbackSize)
+	}
+
+	sort.SliceStable(icons, func(i, j int) bool {
+		return icons[i].Size > icons[j].Size
+	})
+	return icons
+}
+
+// Download saves the largest icon of the page that can be downloaded in the
+// directory and returns its path.
+func Download(ctx context.Context, client *http.Client, pageURL string, links []pipeline.Link, dir string) (string, error) {
+	icons := Icons(ctx, client, pageURL, links)
+	if len(icons) == 0 {
+		return "", fmt.Errorf("the page has no icon")
+	}
+
+	var err error
+	for _, icon := range icons {
+		var path string
+		if path, err = ogimage.Download(ctx, client, icon.URL, dir); err == nil {
+			return path, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	return "", err
+}
+
+// manifestIcon is an icon of a web app manifest.
+type manifestIcon struct {
+	Src     string `json:"src"`
+	Sizes   string `json:"sizes"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose"`
+}
+
+// manifest returns the icons of the web app manifest, or none when it can't
+// be read.
+func manifest(ctx context.Context, client *http.Client, manifestURL string) []manifestIcon {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return nil
+	}
+
+	var m struct {
+		Icons []manifestIcon `json:"icons"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxManifestSize)).Decode(&m); err != nil {
+		return nil
+	}
+	return m.Icons
+}
+
+// size returns the width of the largest of the sizes, like 192 for
+// `48x48 192x192`, treating vector icons as the largest.
+func size(sizes, mediaType, href string, fallback int) int {
+	if mediaType == "image/svg+xml" || strings.EqualFold(strings.TrimSpace(sizes), "any") || strings.HasSuffix(strings.ToLower(href), ".svg") {
+		return vectorSize
+	}
+
+	largest := 0
+	for _, s := range strings.Fields(strings.ToLower(sizes)) {
+		width, _, _ := strings.Cut(s, "x")
+		if n, err := strconv.Atoi(width); err == nil && n > largest {
+			largest = n
+		}
+	}
+	if largest == 0 {
+		return fallback
+	}
+	return largest
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
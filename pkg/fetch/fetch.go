@@ -0,0 +1,204 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/html"
+)
+
+type client struct {
+	browser.Options
+	capture browser.Capture
+}
+
+// New returns a driver that downloads the page with a plain HTTP client,
+// without rendering it. Selectors and waits don't apply.
+func New(o browser.Options) *client {
+	return &client{Options: o}
+}
+
+// Run downloads the page.
+func (c *client) Run(ctx context.Context) error {
+	if c.Login != nil {
+		return errors.NewPuperError(fmt.Errorf("login scripts need a browser"), "Can't run the login script")
+	}
+	if len(c.Scripts) > 0 {
+		return errors.NewPuperError(fmt.Errorf("scripts need a browser"), "Can't run the scripts")
+	}
+	if c.PrintPDF {
+		return errors.NewPuperError(fmt.Errorf("printing needs a browser"), "Can't print the page")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	var proxy *url.URL
+	if c.Proxy != "" {
+		var err error
+		if proxy, err = url.Parse(c.Proxy); err != nil {
+			return errors.NewPuperError(err, "Invalid proxy")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if c.Impersonate != "" {
+		var err error
+		if roundTripper, err = newImpersonator(c.Impersonate, proxy, transport); err != nil {
+			return errors.NewPuperError(err, "Can't impersonate the browser")
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return errors.NewPuperError(err, "Invalid URL")
+	}
+
+	jar, _ := cookiejar.New(nil)
+	for _, cookie := range c.Cookies {
+		saved := &http.Cookie{
+			Name:   cookie.Name,
+			Value:  cookie.Value,
+			Domain: cookie.Domain,
+			Path:   cookie.Path,
+			Secure: cookie.Secure,
+		}
+		if cookie.Expiry > 0 {
+			saved.Expires = time.Unix(cookie.Expiry, 0)
+		}
+		jar.SetCookies(request.URL, []*http.Cookie{saved})
+	}
+	request.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	for name, values := range c.Headers {
+		request.Header[name] = values
+	}
+	if c.Impersonate != "" && request.Header.Get("User-Agent") == "" {
+		request.Header.Set("User-Agent", userAgents[c.Impersonate])
+	}
+	if c.Username != "" {
+		request.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.Sign != nil {
+		if err := c.Sign(request); err != nil {
+			return errors.NewPuperError(err, "Can't sign the request")
+		}
+	}
+
+	var wrote, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	request = request.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	c.Logger.Debug("Getting webpage", "url", c.URL)
+	start := time.Now()
+	response, err := (&http.Client{Transport: roundTripper, Jar: jar}).Do(request)
+	if err != nil {
+		return errors.NewPuperError(err, "Failed to load URL")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return errors.NewPuperError(fmt.Errorf("%s", response.Status), "The server answered with an error")
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return errors.NewPuperError(err, "Failed to read the response")
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	source := body
+	// Decoding binary documents, like PDFs, would corrupt them.
+	if strings.HasPrefix(http.DetectContentType(body), "text/") {
+		name, from := c.Charset, "flag"
+		if name == "" {
+			name, from = html.DetectCharset(body, contentType)
+		}
+		c.Logger.Debug("Decoding the response", "charset", name, "from", from)
+
+		if source, err = html.Decode(body, name); err != nil {
+			return errors.NewPuperError(err, "Can't decode the response")
+		}
+	}
+
+	c.capture = browser.Capture{
+		Source:      string(source),
+		URL:         response.Request.URL.String(),
+		ContentType: contentType,
+	}
+
+	if c.SaveCookies {
+		// The jar only keeps the name and value of the cookies it returns.
+		c.capture.Cookies = []browser.Cookie{}
+		for _, cookie := range jar.Cookies(response.Request.URL) {
+			c.capture.Cookies = append(c.capture.Cookies, browser.Cookie{
+				Name:   cookie.Name,
+				Value:  cookie.Value,
+				Domain: response.Request.URL.Hostname(),
+			})
+		}
+	}
+
+	if c.Perf {
+		c.capture.Metrics = &browser.PerfMetrics{
+			TTFB:         firstByte.Sub(wrote),
+			Load:         time.Since(start),
+			TransferSize: int64(len(body)),
+		}
+	}
+
+	return nil
+}
+
+// GetConsoleMessages returns nil, there is no console without a browser.
+func (c *client) GetConsoleMessages() []browser.ConsoleMessage {
+	return nil
+}
+
+// GetContentType returns the Content-Type of the response downloaded by the
+// `Run` method.
+func (c *client) GetContentType() string {
+	return c.capture.ContentType
+}
+
+// GetCookies returns the cookies of the session captured while running the
+// `Run` method, if they were requested.
+func (c *client) GetCookies() []browser.Cookie {
+	return c.capture.Cookies
+}
+
+// GetPDF returns nil, printing needs a browser.
+func (c *client) GetPDF() []byte {
+	return nil
+}
+
+// GetPerfMetrics returns the request timing captured while running the `Run`
+// method, or nil if it wasn't requested. Only TTFB, Load and TransferSize are
+// set.
+func (c *client) GetPerfMetrics() *browser.PerfMetrics {
+	return c.capture.Metrics
+}
+
+// GetSource returns the body downloaded by the `Run` method.
+func (c *client) GetSource() string {
+	return c.capture.Source
+}
+
+// GetURL returns the URL of the page after following redirects, or the
+// requested one if it wasn't fetched yet.
+func (c *client) GetURL() string {
+	if c.capture.URL == "" {
+		return c.URL
+	}
+	return c.capture.URL
+}
@@ -0,0 +1,181 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/proxy"
+)
+
+// Browsers whose TLS fingerprint can be impersonated.
+const (
+	ImpersonateChrome  = "chrome"
+	ImpersonateFirefox = "firefox"
+	ImpersonateSafari  = "safari"
+)
+
+// helloIDs are the ClientHello messages of the impersonated browsers.
+var helloIDs = map[string]utls.ClientHelloID{
+	ImpersonateChrome:  utls.HelloChrome_Auto,
+	ImpersonateFirefox: utls.HelloFirefox_Auto,
+	ImpersonateSafari:  utls.HelloSafari_Auto,
+}
+
+// userAgents are sent along with the ClientHello of the same browser when
+// no User-Agent is set, so the two don't contradict each other.
+var userAgents = map[string]string{
+	ImpersonateChrome:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36",
+	ImpersonateFirefox: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0",
+	ImpersonateSafari:  "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Safari/605.1.15",
+}
+
+// impersonator makes the TLS handshakes of the HTTPS requests with the
+// ClientHello of a browser, then speaks HTTP/2 or HTTP/1.1 depending on
+// what the server picked. Plain HTTP requests go through the fallback.
+type impersonator struct {
+	hello    utls.ClientHelloID
+	proxy    *url.URL
+	fallback http.RoundTripper
+}
+
+// newImpersonator returns a transport with the TLS fingerprint of the
+// browser, connecting through the SOCKS5 or HTTP proxy if any.
+func newImpersonator(browser string, proxy *url.URL, fallback http.RoundTripper) (*impersonator, error) {
+	hello, ok := helloIDs[browser]
+	if !ok {
+		return nil, fmt.Errorf("unsupported browser to impersonate: %s, expected chrome, firefox or safari", browser)
+	}
+	if proxy != nil {
+		switch proxy.Scheme {
+		case "socks5", "socks5h", "http":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme to impersonate a browser: %s, expected socks5 or http", proxy.Scheme)
+		}
+	}
+	return &impersonator{hello: hello, proxy: proxy, fallback: fallback}, nil
+}
+
+// RoundTrip sends the request over a new connection.
+func (t *impersonator) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme != "https" {
+		return t.fallback.RoundTrip(r)
+	}
+
+	conn, err := t.dial(r.Context(), r.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		client, err := (&http2.Transport{}).NewClientConn(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		response, err := client.RoundTrip(r)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		response.Body = &closer{ReadCloser: response.Body, close: client.Close}
+		return response, nil
+	}
+
+	transport := &http.Transport{
+		DialTLSContext:    func(context.Context, string, string) (net.Conn, error) { return conn, nil },
+		DisableKeepAlives: true,
+	}
+	return transport.RoundTrip(r)
+}
+
+// dial connects to the host of the URL and makes the TLS handshake.
+func (t *impersonator) dial(ctx context.Context, u *url.URL) (*utls.UConn, error) {
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	raw, err := dialTCP(ctx, t.proxy, address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := utls.UClient(raw, &utls.Config{ServerName: u.Hostname()}, t.hello)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialTCP connects to the address, through the proxy if any.
+func dialTCP(ctx context.Context, proxyURL *url.URL, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if proxyURL == nil {
+		return dialer.DialContext(ctx, "tcp", address)
+	}
+
+	if proxyURL.Scheme != "http" {
+		socks, err := proxy.FromURL(proxyURL, dialer)
+		if err != nil {
+			return nil, err
+		}
+		return socks.(proxy.ContextDialer).DialContext(ctx, "tcp", address)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	connect := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		connect.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := connect.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// The proxy sends nothing after its answer until the handshake starts,
+	// so the reader doesn't buffer anything past it.
+	response, err := http.ReadResponse(bufio.NewReader(conn), connect)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("the proxy refused to connect to %s: %s", address, response.Status)
+	}
+	return conn, nil
+}
+
+// closer closes the HTTP/2 connection along with the body of its response.
+type closer struct {
+	io.ReadCloser
+	close func() error
+}
+
+func (c *closer) Close() error {
+	err := c.ReadCloser.Close()
+	c.close()
+	return err
+}
@@ -0,0 +1,69 @@
+package geckodriver
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+)
+
+// consoleWriter collects the console messages Firefox writes to its output
+// when the `devtools.console.stdout.content` preference is enabled.
+type consoleWriter struct {
+	mu       sync.Mutex
+	partial  []byte
+	messages []browser.ConsoleMessage
+}
+
+// Write splits the output in lines and keeps the ones that are console
+// messages.
+func (w *consoleWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := string(bytes.TrimRight(w.partial[:i], "\r"))
+		w.partial = w.partial[i+1:]
+
+		if message, ok := parseConsoleLine(line); ok {
+			w.messages = append(w.messages, message)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Messages returns the messages collected so far.
+func (w *consoleWriter) Messages() []browser.ConsoleMessage {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]browser.ConsoleMessage{}, w.messages...)
+}
+
+// parseConsoleLine recognizes the `console.<level>: text` lines printed for
+// the console API and the `JavaScript error: ...` lines printed for uncaught
+// errors.
+func parseConsoleLine(line string) (browser.ConsoleMessage, bool) {
+	if rest, ok := strings.CutPrefix(line, "console."); ok {
+		level, text, found := strings.Cut(rest, ":")
+		if !found || strings.ContainsAny(level, " \t") {
+			return browser.ConsoleMessage{}, false
+		}
+		return browser.ConsoleMessage{Level: level, Text: strings.TrimSpace(text)}, true
+	}
+
+	for _, level := range []string{"error", "warning"} {
+		if text, ok := strings.CutPrefix(line, "JavaScript "+level+":"); ok {
+			return browser.ConsoleMessage{Level: level, Text: strings.TrimSpace(text)}, true
+		}
+	}
+
+	return browser.ConsoleMessage{}, false
+}
@@ -1,172 +1,411 @@
 package geckodriver
 
 import (
+	"context"
 	"fmt"
+	stdnet "net"
+	"net/url"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/charmbracelet/log"
-	"github.com/cloudbridgeuy/puper/pkg/errors"
-	"github.com/cloudbridgeuy/puper/pkg/logger"
-	"github.com/shirou/gopsutil/process"
 	"github.com/tebeka/selenium"
+	"github.com/tebeka/selenium/firefox"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	"github.com/cloudbridgeuy/puper/pkg/net"
 )
 
 type geckodriver struct {
-	binary    string
-	port      int
-	logger    *log.Logger
-	url       string
-	selectors []string
-	wait      int
-	source    string
+	browser.Options
+	prefs   map[string]interface{}
+	console *consoleWriter
+	capture browser.Capture
 }
 
-type builder struct {
-	inner *geckodriver
+// New returns a driver that renders the page with Firefox.
+func New(o browser.Options) *geckodriver {
+	g := &geckodriver{
+		Options: o,
+		prefs:   map[string]interface{}{},
+	}
+	if o.ConsoleLog {
+		g.console = &consoleWriter{}
+	}
+	return g
 }
 
-func NewGeckodriverBuilder() *builder {
-	return &builder{
-		inner: &geckodriver{},
+// Run starts geckodriver and fetches the page source. Cancelling the context
+// kills geckodriver, which aborts the WebDriver session.
+func (g *geckodriver) Run(ctx context.Context) error {
+	s, err := g.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	g.capture, err = browser.Load(ctx, s.wd, g.Options, g.GetConsoleMessages)
+	if err != nil && ctx.Err() != nil {
+		return errors.NewPuperError(ctx.Err(), "Geckodriver was interrupted")
 	}
+	return err
 }
 
-// WithDefaultLogger sets the default logger instance on the Geckodriver struct.
-func (b *builder) WithDefaultLogger() *builder {
-	b.inner.logger = logger.Logger
-	return b
+// Session is a running geckodriver with an open WebDriver session, which can
+// load several pages without starting Firefox again.
+type Session struct {
+	g       *geckodriver
+	command *exec.Cmd
+	exited  chan struct{}
+	wd      selenium.WebDriver
+	// width and height are the size of the window when the session opened,
+	// which Reset restores. Zero when it couldn't be read.
+	width, height int
 }
 
-// WithLogger sets the default logger instance on the Geckodriver struct.
-func (b *builder) WithLogger(log.Logger) *builder {
-	b.inner.logger = logger.Logger
-	return b
+// Open starts geckodriver and opens a WebDriver session with the browser
+// settings of the options. Cancelling the context kills geckodriver.
+func Open(ctx context.Context, o browser.Options) (*Session, error) {
+	return New(o).open(ctx)
 }
 
-// WithBinary sets the binary for the Geckodriver.
-func (b *builder) WithBinary(binary string) *builder {
-	b.inner.binary = binary
-	return b
-}
+// Load navigates to the page of the options and captures it, returning the
+// console messages logged meanwhile. Only the page settings of the options
+// are used: URL, selectors, wait, perf and fail-on.
+func (s *Session) Load(ctx context.Context, o browser.Options) (browser.Capture, []browser.ConsoleMessage, error) {
+	seen := len(s.g.GetConsoleMessages())
+	console := func() []browser.ConsoleMessage {
+		return s.g.GetConsoleMessages()[seen:]
+	}
 
-// WithPort sets the port for the Geckodriver.
-func (b *builder) WithPort(port int) *builder {
-	b.inner.port = port
-	return b
+	capture, err := browser.Load(ctx, s.wd, o, console)
+	return capture, console(), err
 }
 
-// WithSelectors sets the selectors for the Geckodriver.
-func (b *builder) WithSelectors(selectors []string) *builder {
-	b.inner.selectors = selectors
-	return b
+// Alive tells whether the browser of the session still answers.
+func (s *Session) Alive() bool {
+	_, err := s.wd.CurrentURL()
+	return err == nil
 }
 
-// WithUrl sets the URL for the Geckodriver.
-func (b *builder) WithUrl(url string) *builder {
-	b.inner.url = url
-	return b
+// Reset deletes the cookies and the storage of the page loaded last, restores
+// the size of the window and leaves the page, so the next page loaded in the
+// session doesn't see them. WebDriver only reaches the cookies of the current
+// page, the ones other sites set along the way are kept. It fails when the
+// browser is gone.
+func (s *Session) Reset() error {
+	if err := s.wd.DeleteAllCookies(); err != nil {
+		return err
+	}
+	if s.width > 0 && s.height > 0 {
+		if err := s.wd.ResizeWindow("", s.width, s.height); err != nil {
+			return err
+		}
+	}
+	if _, err := s.wd.ExecuteScript(`try {
+  localStorage.clear();
+  sessionStorage.clear();
+} catch (e) {}`, nil); err != nil {
+		return err
+	}
+	return s.wd.Get("about:blank")
 }
 
-// WithWait sets the URL for the Geckodriver.
-func (b *builder) WithWait(wait int) *builder {
-	b.inner.wait = wait
-	return b
+// newSession returns the session of the WebDriver client, remembering the
+// size of its window for Reset.
+func (g *geckodriver) newSession(wd selenium.WebDriver, command *exec.Cmd, exited chan struct{}) *Session {
+	s := &Session{g: g, command: command, exited: exited, wd: wd}
+
+	// WebDriver sizes the outer window, so its outer size is restored.
+	value, err := wd.ExecuteScript(`return [window.outerWidth, window.outerHeight];`, nil)
+	size, ok := value.([]interface{})
+	if err != nil || !ok || len(size) != 2 {
+		g.Logger.Debug("Can't read the window size, Reset keeps the last one", "err", err)
+		return s
+	}
+	width, _ := size[0].(float64)
+	height, _ := size[1].(float64)
+	s.width, s.height = int(width), int(height)
+	return s
 }
 
-// Build returns the inner struct
-func (b *builder) Build() *geckodriver {
-	return b.inner
+// Close quits the WebDriver session and kills geckodriver, unless the
+// session is on a remote server.
+func (s *Session) Close() {
+	s.g.Logger.Debug("Quitting webdriver client")
+	s.wd.Quit()
+	if s.command != nil {
+		s.g.kill(s.command, s.exited)
+	}
 }
 
-func (g *geckodriver) Run() error {
-	g.logger.Debug("Prepare the geckodriver command.")
-	command := exec.Command("geckodriver")
-	command.Env = append(os.Environ(), "MOZ_HEADLESS=1", "MOZ_REMOTE_SETTINGS_DEVTOOLS=1")
-	command.Args = append(command.Args, fmt.Sprintf("--port=%d", g.port), "-b", g.binary)
+// portAttempts is how many random ports are tried when geckodriver can't
+// listen on the one picked, because another process took it meanwhile.
+const portAttempts = 3
 
-	g.logger.Debug("", "$", strings.Join(command.Args, " "))
-	if err := command.Start(); err != nil {
-		return errors.NewPuperError(err, "Failed to start geckodriver")
+func (g *geckodriver) open(ctx context.Context) (*Session, error) {
+	if g.Proxy != "" {
+		prefs, err := proxyPreferences(g.Proxy)
+		if err != nil {
+			return nil, errors.NewPuperError(err, "Invalid proxy")
+		}
+		for name, value := range prefs {
+			g.prefs[name] = value
+		}
 	}
 
-	defer func() {
-		g.logger.Debug("Killing geckodriver")
-		command.Process.Kill()
-	}()
+	for name, values := range g.Headers {
+		switch name {
+		case "Accept-Language":
+			g.prefs["intl.accept_languages"] = strings.Join(values, ",")
+		case "User-Agent":
+			g.prefs["general.useragent.override"] = values[0]
+		default:
+			return nil, errors.NewPuperError(fmt.Errorf("firefox can't send the %s header through WebDriver", name), "Can't set the request headers")
+		}
+	}
+
+	if g.Viewport != nil && g.Viewport.Mobile {
+		// Firefox can't emulate the pixel ratio of a device without shrinking
+		// the page, only its touch screen.
+		g.prefs["dom.w3c_touch_events.enabled"] = 1
+	}
 
-	g.logger.Debug("Checking for Firefox process")
-	timeoutDuration := 10 * time.Second
-	sleepInterval := 500 * time.Millisecond
-	startTime := time.Now()
+	if g.Username != "" {
+		// Skips the confirmation Firefox asks for before logging in with the
+		// credentials of the URL.
+		g.prefs["network.http.phishy-userpass-length"] = 255
+	}
 
-	for {
-		if time.Since(startTime) >= timeoutDuration {
-			return errors.NewPuperError(fmt.Errorf("Timeout"), "Failed to detect a running Firefox instance")
+	if g.RemoteURL != "" {
+		if g.console != nil {
+			g.Logger.Warn("The console log isn't available with a remote WebDriver server")
+		}
+		if !g.Limits.IsZero() {
+			g.Logger.Warn("Resource limits don't apply to a remote WebDriver server")
 		}
 
-		processes, err := process.Processes()
+		wd, err := g.connect(g.RemoteURL)
 		if err != nil {
-			return errors.NewPuperError(err, "Failed to get processes")
+			return nil, err
 		}
+		return g.newSession(wd, nil, nil), nil
+	}
 
-		for _, p := range processes {
-			name, err := p.Name()
-			if err == nil && name == "firefox" {
-				g.logger.Debug("Headless Firefox instance detected")
-				return g.webdriver()
+	random := g.Port == 0
+	for attempt := 1; ; attempt++ {
+		if random {
+			port, err := net.GetRandomUnusedPort(g.Bind)
+			if err != nil {
+				return nil, errors.NewPuperError(err, "Can't get a random unused port from the OS")
 			}
+			g.Port = port
+		}
+
+		command, exited, err := g.start(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		wd, err := g.webdriver(ctx, command, exited)
+		if err == nil {
+			return g.newSession(wd, command, exited), nil
 		}
 
-		time.Sleep(sleepInterval)
+		g.kill(command, exited)
+		if ctx.Err() != nil {
+			return nil, errors.NewPuperError(ctx.Err(), "Geckodriver was interrupted")
+		}
+
+		if random && attempt < portAttempts && isClosed(exited) && net.PortInUse(g.Bind, g.Port) {
+			g.Logger.Warn("The port was taken, retrying with another one", "port", g.Port)
+			continue
+		}
+		return nil, err
 	}
 }
 
-func (g *geckodriver) webdriver() error {
-	g.logger.Debug("Starting firefox control through geckodriver using the webdriver protocol")
+// start starts geckodriver. The returned channel is closed once it exits.
+func (g *geckodriver) start(ctx context.Context) (*exec.Cmd, chan struct{}, error) {
+	g.Logger.Debug("Prepare the geckodriver command.")
+	binary := "geckodriver"
+	if g.Driver != "" {
+		binary = g.Driver
+	}
 
-	url := fmt.Sprintf("http://localhost:%d", g.port)
-	caps := selenium.Capabilities{"browserName": "firefox"}
+	command := exec.CommandContext(ctx, binary)
+	command.Env = append(os.Environ(), "MOZ_HEADLESS=1", "MOZ_REMOTE_SETTINGS_DEVTOOLS=1")
+	command.Args = append(command.Args, "--host", g.Bind, fmt.Sprintf("--port=%d", g.Port))
+	if g.Binary != "" {
+		command.Args = append(command.Args, "-b", g.Binary)
+	}
+	command.Args = append(command.Args, g.DriverArgs...)
 
-	g.logger.Debug("Creating webdriver client connection", "url", url)
-	wd, err := selenium.NewRemote(caps, url)
-	defer func() {
-		g.logger.Debug("Quitting webdriver client")
-		wd.Quit()
+	if g.console != nil {
+		g.prefs["devtools.console.stdout.content"] = true
+		command.Stdout = g.console
+		command.Stderr = g.console
+	}
+
+	if g.Limits.Memory > 0 {
+		scope, err := browser.MemoryScope(g.Limits.Memory)
+		if err != nil {
+			return nil, nil, errors.NewPuperError(err, "Can't limit the browser memory")
+		}
+		browser.Confine(command, scope)
+	}
+
+	g.Logger.Debug("", "$", strings.Join(command.Args, " "))
+	if err := command.Start(); err != nil {
+		return nil, nil, errors.NewPuperError(err, "Failed to start geckodriver")
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		command.Wait()
+		close(exited)
 	}()
 
+	return command, exited, nil
+}
+
+// kill kills geckodriver and waits for it to exit.
+func (g *geckodriver) kill(command *exec.Cmd, exited chan struct{}) {
+	g.Logger.Debug("Killing geckodriver")
+	command.Process.Kill()
+	<-exited
+}
+
+func (g *geckodriver) webdriver(ctx context.Context, command *exec.Cmd, exited chan struct{}) (selenium.WebDriver, error) {
+	if err := browser.ApplyLimits(command.Process.Pid, g.Limits); err != nil {
+		return nil, errors.NewPuperError(err, "Can't limit the browser resources")
+	}
+
+	url := fmt.Sprintf("http://%s", stdnet.JoinHostPort(g.Bind, strconv.Itoa(g.Port)))
+	g.Logger.Debug("Waiting for geckodriver to be ready", "url", url)
+	if err := browser.WaitReady(ctx, url, g.StartupTimeout, exited); err != nil {
+		return nil, errors.NewPuperError(err, "Geckodriver didn't start")
+	}
+
+	return g.connect(url)
+}
+
+// connect opens a WebDriver session on the server listening at url.
+func (g *geckodriver) connect(url string) (selenium.WebDriver, error) {
+	g.Logger.Debug("Starting firefox control through geckodriver using the webdriver protocol")
+
+	caps := selenium.Capabilities{"browserName": "firefox"}
+	caps.AddFirefox(firefox.Capabilities{Prefs: g.prefs})
+
+	g.Logger.Debug("Creating webdriver client connection", "url", url)
+	wd, err := selenium.NewRemote(caps, url)
 	if err != nil {
-		return errors.NewPuperError(err, "Failed to create WebDriver client")
+		return nil, errors.NewPuperError(err, "Failed to create WebDriver client")
+	}
+
+	return browser.Remote{WebDriver: wd, Server: url}, nil
+}
+
+// isClosed reports whether the channel is closed.
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
 	}
+}
 
-	g.logger.Debug("Getting webpage")
-	err = wd.Get(g.url)
+// proxyPreferences returns the Firefox preferences that route all the
+// traffic through the proxy URL. DNS lookups go through SOCKS proxies too.
+func proxyPreferences(proxy string) (map[string]interface{}, error) {
+	u, err := url.Parse(proxy)
 	if err != nil {
-		return errors.NewPuperError(err, "Failed to load URL")
+		return nil, err
 	}
 
-	if len(g.selectors) > 0 && g.selectors[0] != "*" && g.selectors[0] != "" {
-		g.logger.Debug("Waiting for locator", "selector", g.selectors[0])
-		_, err := wd.FindElement(selenium.ByCSSSelector, g.selectors[0])
-		if err != nil {
-			return errors.NewPuperError(err, "Failed to find element")
-		}
-	} else {
-		g.logger.Debug("Waiting for page to load", "seconds", g.wait)
-		time.Sleep(time.Duration(g.wait) * time.Second)
+	host, port, err := stdnet.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, err
 	}
 
-	g.source, err = wd.PageSource()
+	portNumber, err := strconv.Atoi(port)
 	if err != nil {
-		return errors.NewPuperError(err, "Failed to get page source")
+		return nil, fmt.Errorf("invalid port: %s", port)
+	}
+
+	prefs := map[string]interface{}{
+		"network.proxy.type":          1,
+		"network.proxy.no_proxies_on": "",
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h", "socks":
+		prefs["network.proxy.socks"] = host
+		prefs["network.proxy.socks_port"] = portNumber
+		prefs["network.proxy.socks_version"] = 5
+		prefs["network.proxy.socks_remote_dns"] = true
+	case "socks4":
+		prefs["network.proxy.socks"] = host
+		prefs["network.proxy.socks_port"] = portNumber
+		prefs["network.proxy.socks_version"] = 4
+	case "http", "https":
+		prefs["network.proxy.http"] = host
+		prefs["network.proxy.http_port"] = portNumber
+		prefs["network.proxy.ssl"] = host
+		prefs["network.proxy.ssl_port"] = portNumber
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", u.Scheme)
 	}
 
-	return nil
+	return prefs, nil
+}
+
+// GetConsoleMessages returns the console messages captured while running the
+// `Run` method, if the console log was enabled.
+func (g *geckodriver) GetConsoleMessages() []browser.ConsoleMessage {
+	if g.console == nil {
+		return nil
+	}
+	return g.console.Messages()
+}
+
+// GetContentType returns an empty string, the browser renders every page as
+// HTML.
+func (g *geckodriver) GetContentType() string {
+	return ""
+}
+
+// GetCookies returns the cookies of the session captured while running the
+// `Run` method, if they were requested.
+func (g *geckodriver) GetCookies() []browser.Cookie {
+	return g.capture.Cookies
+}
+
+// GetPDF returns the page printed while running the `Run` method, if it was
+// requested.
+func (g *geckodriver) GetPDF() []byte {
+	return g.capture.PDF
+}
+
+// GetPerfMetrics returns the navigation timing captured while running the
+// `Run` method, or nil if it wasn't requested or available.
+func (g *geckodriver) GetPerfMetrics() *browser.PerfMetrics {
+	return g.capture.Metrics
 }
 
 // GetSource returns the source found after running the `Run` method.
-func (g geckodriver) GetSource() string {
-	return g.source
+func (g *geckodriver) GetSource() string {
+	return g.capture.Source
+}
+
+// GetURL returns the URL of the page after following redirects, or the
+// requested one if it wasn't fetched yet.
+func (g *geckodriver) GetURL() string {
+	if g.capture.URL == "" {
+		return g.URL
+	}
+	return g.capture.URL
 }
@@ -0,0 +1,80 @@
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HAR is the root of an HTTP Archive file. Only the fields puper needs are
+// decoded.
+type HAR struct {
+	Log struct {
+		Entries []Entry `json:"entries"`
+	} `json:"log"`
+}
+
+// Entry is a single request/response pair of the archive.
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Request         struct {
+		URL string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status  int `json:"status"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// Document is an HTML response found in the archive.
+type Document struct {
+	URL  string
+	Body []byte
+	// FetchedAt is when the request was sent.
+	FetchedAt time.Time
+	// Decoded is true when the body was stored as text, which the HAR format
+	// defines as already decoded to UTF-8.
+	Decoded bool
+}
+
+// Read decodes a HAR file.
+func Read(r io.Reader) (HAR, error) {
+	var h HAR
+	err := json.NewDecoder(r).Decode(&h)
+	return h, err
+}
+
+// Documents returns the HTML responses with a body whose URL matches the
+// pattern, in the order they were recorded. A nil pattern matches any URL.
+func (h HAR) Documents(pattern *regexp.Regexp) ([]Document, error) {
+	documents := []Document{}
+	for _, entry := range h.Log.Entries {
+		content := entry.Response.Content
+		if !strings.Contains(content.MimeType, "html") || content.Text == "" {
+			continue
+		}
+
+		if pattern != nil && !pattern.MatchString(entry.Request.URL) {
+			continue
+		}
+
+		document := Document{URL: entry.Request.URL, Body: []byte(content.Text), FetchedAt: entry.StartedDateTime, Decoded: true}
+		if content.Encoding == "base64" {
+			body, err := base64.StdEncoding.DecodeString(content.Text)
+			if err != nil {
+				return nil, err
+			}
+			document.Body, document.Decoded = body, false
+		}
+
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
@@ -0,0 +1,122 @@
+package html
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Where the charset of a document came from.
+const (
+	CharsetFromContentType = "content-type"
+	CharsetFromMeta        = "meta"
+	CharsetFromBOM         = "bom"
+	CharsetFromDefault     = "default"
+)
+
+// DetectCharset returns the name of the charset of an HTTP response body and
+// where it was found, looking at the charset of the Content-Type header, then
+// at the `<meta>` tags of the document, then at its byte order mark. Bodies
+// with none of them are UTF-8 when valid, or windows-1252.
+func DetectCharset(body []byte, contentType string) (name string, from string) {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if _, name := charset.Lookup(params["charset"]); name != "" {
+			return name, CharsetFromContentType
+		}
+	}
+
+	if name := metaCharset(body); name != "" {
+		return name, CharsetFromMeta
+	}
+
+	if name := bomCharset(body); name != "" {
+		return name, CharsetFromBOM
+	}
+
+	if utf8.Valid(body) {
+		return "utf-8", CharsetFromDefault
+	}
+	_, name, _ = charset.DetermineEncoding(body, "")
+	return name, CharsetFromDefault
+}
+
+// metaCharset returns the charset declared by the `<meta>` tags in the first
+// kilobyte of the body, like browsers do, if any.
+func metaCharset(body []byte) string {
+	if len(body) > 1024 {
+		body = body[:1024]
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.Data != "meta" {
+				continue
+			}
+
+			var declared, content, httpEquiv string
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "charset":
+					declared = attr.Val
+				case "content":
+					content = attr.Val
+				case "http-equiv":
+					httpEquiv = attr.Val
+				}
+			}
+			if declared == "" && strings.EqualFold(httpEquiv, "content-type") {
+				if _, params, err := mime.ParseMediaType(content); err == nil {
+					declared = params["charset"]
+				}
+			}
+
+			if _, name := charset.Lookup(declared); name != "" {
+				// A document can't declare a UTF-16 charset in ASCII.
+				if strings.HasPrefix(name, "utf-16") {
+					return "utf-8"
+				}
+				return name
+			}
+		}
+	}
+}
+
+// Decode converts the body from the charset to UTF-8, dropping the byte
+// order mark of that charset.
+func Decode(body []byte, name string) ([]byte, error) {
+	e, canonical := charset.Lookup(name)
+	if e == nil {
+		return nil, fmt.Errorf("unsupported charset: %s", name)
+	}
+	if bomCharset(body) == canonical {
+		body = body[len(boms[canonical]):]
+	}
+	return e.NewDecoder().Bytes(body)
+}
+
+var boms = map[string][]byte{
+	"utf-8":    {0xef, 0xbb, 0xbf},
+	"utf-16be": {0xfe, 0xff},
+	"utf-16le": {0xff, 0xfe},
+}
+
+// bomCharset returns the charset of the byte order mark the body starts
+// with, if any.
+func bomCharset(body []byte) string {
+	for name, bom := range boms {
+		if bytes.HasPrefix(body, bom) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package html
+
+import "testing"
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+		wantFrom    string
+	}{
+		{"content type", `<meta charset="utf-8">`, "text/html; charset=ISO-8859-2", "iso-8859-2", CharsetFromContentType},
+		{"content type alias", "", "text/html; charset=latin1", "windows-1252", CharsetFromContentType},
+		{"unknown content type charset", `<meta charset="shift_jis">`, "text/html; charset=bogus", "shift_jis", CharsetFromMeta},
+		{"meta charset", `<html><head><meta charset="EUC-JP"></head>`, "text/html", "euc-jp", CharsetFromMeta},
+		{"meta http-equiv", `<meta http-equiv="Content-Type" content="text/html; charset=koi8-r">`, "", "koi8-r", CharsetFromMeta},
+		{"meta utf-16 is utf-8", `<meta charset="utf-16">`, "", "utf-8", CharsetFromMeta},
+		{"meta after the first kilobyte", "<!--" + string(make([]byte, 1100)) + `--><meta charset="koi8-r">`, "", "utf-8", CharsetFromDefault},
+		{"utf-8 bom", "\xef\xbb\xbf<p>hi</p>", "", "utf-8", CharsetFromBOM},
+		{"utf-16le bom", "\xff\xfe<\x00p\x00>\x00", "", "utf-16le", CharsetFromBOM},
+		{"utf-16be bom", "\xfe\xff\x00<\x00p\x00>", "", "utf-16be", CharsetFromBOM},
+		{"valid utf-8", "<p>héllo</p>", "text/html", "utf-8", CharsetFromDefault},
+		{"invalid utf-8", "<p>h\xe9llo</p>", "", "windows-1252", CharsetFromDefault},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, from := DetectCharset([]byte(tt.body), tt.contentType)
+			if got != tt.want || from != tt.wantFrom {
+				t.Errorf("DetectCharset(%q, %q) = %q, %q, want %q, %q", tt.body, tt.contentType, got, from, tt.want, tt.wantFrom)
+			}
+		})
+	}
+}
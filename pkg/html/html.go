@@ -1,6 +1,7 @@
 package html
 
 import (
+	"context"
 	"fmt"
 	"io"
 
@@ -9,10 +10,13 @@ import (
 	"golang.org/x/text/transform"
 )
 
-// ParseHTML parses the HTML while rendering the charset
-func ParseHTML(r io.Reader, cs string) (*html.Node, error) {
+// ParseHTML parses the HTML while rendering the charset. Reading stops with
+// the context error once the context is done.
+func ParseHTML(ctx context.Context, r io.Reader, cs string) (*html.Node, error) {
 	var err error
 
+	r = contextReader{ctx, r}
+
 	if cs == "" {
 		// Attempt to guess the charset of the HTML document.
 		r, err = charset.NewReader(r, "")
@@ -29,3 +33,16 @@ func ParseHTML(r io.Reader, cs string) (*html.Node, error) {
 	}
 	return html.Parse(r)
 }
+
+// contextReader fails reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -2,6 +2,7 @@ package html
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -12,7 +13,7 @@ import (
 	"golang.org/x/net/html"
 )
 
-func Get(root *html.Node, selectors []string) ([]*html.Node, error) {
+func Get(ctx context.Context, root *html.Node, selectors []string) ([]*html.Node, error) {
 	selectorFuncs := []selectorFunc{}
 	funcGenerator := Select
 	var selector string
@@ -41,6 +42,10 @@ func Get(root *html.Node, selectors []string) ([]*html.Node, error) {
 	currNodes := []*html.Node{root}
 
 	for _, selectorFunc := range selectorFuncs {
+		if err := ctx.Err(); err != nil {
+			return []*html.Node{}, err
+		}
+
 		if selectorFunc == nil { // hit a comma
 			selectedNodes = append(selectedNodes, currNodes...)
 			currNodes = []*html.Node{root}
@@ -53,6 +58,17 @@ func Get(root *html.Node, selectors []string) ([]*html.Node, error) {
 	return selectedNodes, nil
 }
 
+// ValidateSelector checks that a single selector, as passed to Get, can be
+// parsed.
+func ValidateSelector(selector string) error {
+	switch selector {
+	case "*", ">", "+", ",":
+		return nil
+	}
+	_, err := ParseSelector(selector)
+	return err
+}
+
 type selector interface {
 	Match(node *html.Node) bool
 }
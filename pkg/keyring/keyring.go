@@ -0,0 +1,96 @@
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	gokeyring "github.com/zalando/go-keyring"
+
+	"github.com/cloudbridgeuy/puper/pkg/browser"
+)
+
+// Kinds of credentials, named after the flags that use them.
+const (
+	// KindAuth is a basic authentication USER:PASSWORD.
+	KindAuth = "auth"
+	// KindBearer is a token sent in the Authorization header.
+	KindBearer = "bearer"
+	// KindCookies is a Cookie header, as in `name=value; other=value`.
+	KindCookies = "cookies"
+)
+
+// Reference is the flag value that reads the credential from the keyring,
+// for the host of the page or, as `keyring:HOST`, for the given host.
+const Reference = "keyring"
+
+// service is the name the credentials are stored under in the OS keyring.
+const service = "puper"
+
+// IsReference reports whether the flag value reads the credential from the
+// keyring.
+func IsReference(value string) bool {
+	return value == Reference || strings.HasPrefix(value, Reference+":")
+}
+
+// Host returns the host the reference points to, the host of the page when
+// it names none.
+func Host(reference, page string) (string, error) {
+	if host, ok := strings.CutPrefix(reference, Reference+":"); ok && host != "" {
+		return NormalizeHost(host), nil
+	}
+	u, err := url.Parse(page)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("%s needs a URL to know the host, use %s:HOST", reference, Reference)
+	}
+	return NormalizeHost(u.Hostname()), nil
+}
+
+// NormalizeHost returns the host in lower case, taken out of the URL if it
+// is one.
+func NormalizeHost(host string) string {
+	if u, err := url.Parse(host); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return strings.ToLower(strings.TrimSpace(host))
+}
+
+// Set stores the credential of the host in the OS keyring.
+func Set(host, kind, secret string) error {
+	return gokeyring.Set(service, account(host, kind), secret)
+}
+
+// Get returns the credential of the host stored in the OS keyring.
+func Get(host, kind string) (string, error) {
+	secret, err := gokeyring.Get(service, account(host, kind))
+	if errors.Is(err, gokeyring.ErrNotFound) {
+		return "", fmt.Errorf("no %s credential stored for %s, run 'puper auth set %s --kind %s'", kind, host, host, kind)
+	}
+	return secret, err
+}
+
+// Delete removes the credential of the host from the OS keyring.
+func Delete(host, kind string) error {
+	err := gokeyring.Delete(service, account(host, kind))
+	if errors.Is(err, gokeyring.ErrNotFound) {
+		return fmt.Errorf("no %s credential stored for %s", kind, host)
+	}
+	return err
+}
+
+// Cookies parses a Cookie header into the cookies of the host.
+func Cookies(header, host string) []browser.Cookie {
+	request := http.Request{Header: http.Header{"Cookie": {header}}}
+
+	cookies := []browser.Cookie{}
+	for _, c := range request.Cookies() {
+		cookies = append(cookies, browser.Cookie{Name: c.Name, Value: c.Value, Domain: host, Path: "/"})
+	}
+	return cookies
+}
+
+func account(host, kind string) string {
+	return kind + "@" + host
+}
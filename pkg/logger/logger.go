@@ -17,17 +17,34 @@ func Verbose() {
 	Logger.SetLevel(log.DebugLevel)
 }
 
+// SetDestination sends the log output to stderr or, for any other value, to
+// the file found at that path. Logs are appended to existing files.
+func SetDestination(destination string) error {
+	if destination == "" || destination == "stderr" {
+		Logger.SetOutput(os.Stderr)
+		return nil
+	}
+
+	file, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	Logger.SetOutput(file)
+	return nil
+}
+
 // Debug logs a debug message.
 func Debug(msg interface{}, keyvals ...interface{}) {
-	Logger.Debug(msg, keyvals)
+	Logger.Debug(msg, keyvals...)
 }
 
 // Info logs an info message.
 func Info(msg interface{}, keyvals ...interface{}) {
-	Logger.Info(msg, keyvals)
+	Logger.Info(msg, keyvals...)
 }
 
 // Error logs an error message.
 func Error(msg interface{}, keyvals ...interface{}) {
-	Logger.Error(msg, keyvals)
+	Logger.Error(msg, keyvals...)
 }
@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cloudbridgeuy/puper/pkg/output"
+)
+
+// Manifest is the index of the documents produced by one or several runs,
+// for the loaders ingesting them.
+type Manifest struct {
+	Documents []Entry `json:"documents" yaml:"documents"`
+}
+
+// Entry describes a produced document.
+type Entry struct {
+	URL   string `json:"url,omitempty" yaml:"url,omitempty"`
+	Title string `json:"title,omitempty" yaml:"title,omitempty"`
+	// Path is the file the document was written to, empty for stdout.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Hash is the SHA-256 of the printed document, like `sha256:3a7b…`.
+	Hash  string `json:"hash" yaml:"hash"`
+	Words int    `json:"words" yaml:"words"`
+	// FetchedAt and ProcessedAt are RFC 3339 timestamps. FetchedAt is empty
+	// for local files.
+	FetchedAt   string `json:"fetched_at,omitempty" yaml:"fetched_at,omitempty"`
+	ProcessedAt string `json:"processed_at" yaml:"processed_at"`
+}
+
+// Timestamp formats a time for an entry, or returns an empty string for the
+// zero time.
+func Timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Read reads the manifest at path, as YAML when its extension is `.yaml` or
+// `.yml` and as JSON otherwise. A missing file is an empty manifest.
+func Read(path string) (Manifest, error) {
+	m := Manifest{Documents: []Entry{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+
+	if isYAML(path) {
+		err = yaml.Unmarshal(data, &m)
+	} else {
+		err = json.Unmarshal(data, &m)
+	}
+	if m.Documents == nil {
+		m.Documents = []Entry{}
+	}
+	return m, err
+}
+
+// Add adds the entry, replacing the one of the same document from a
+// previous run. Documents are the same when they have the same URL and
+// path.
+func (m *Manifest) Add(e Entry) {
+	for i, existing := range m.Documents {
+		if existing.URL == e.URL && existing.Path == e.Path {
+			m.Documents[i] = e
+			return
+		}
+	}
+	m.Documents = append(m.Documents, e)
+}
+
+// Write writes the manifest atomically to path, in the format Read expects.
+func (m Manifest) Write(path string) error {
+	var b bytes.Buffer
+	if isYAML(path) {
+		encoder := yaml.NewEncoder(&b)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(m); err != nil {
+			return err
+		}
+	} else {
+		encoder := json.NewEncoder(&b)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(m); err != nil {
+			return err
+		}
+	}
+
+	file, err := output.Open(path, output.ModeOverwrite)
+	if err != nil {
+		return err
+	}
+	defer file.Discard()
+
+	if _, err := b.WriteTo(file); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,709 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/cloudbridgeuy/puper/pkg/outline"
+	"github.com/cloudbridgeuy/puper/pkg/text"
+)
+
+// blockElements start a block of their own: a paragraph, a heading, a list…
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Body: true, atom.Dd: true, atom.Details: true, atom.Dialog: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.Form: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+	atom.H6: true, atom.Header: true, atom.Hgroup: true, atom.Hr: true,
+	atom.Html: true, atom.Li: true, atom.Main: true, atom.Nav: true, atom.Ol: true,
+	atom.P: true, atom.Pre: true, atom.Section: true, atom.Summary: true,
+	atom.Table: true, atom.Ul: true,
+}
+
+// skippedElements have nothing to read.
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Noscript: true, atom.Script: true, atom.Style: true,
+	atom.Template: true,
+}
+
+// FigureMode controls how `<figure>` elements are rendered.
+type FigureMode string
+
+const (
+	// FigureCaption renders the content of the figure with its caption in
+	// italics on the next line.
+	FigureCaption FigureMode = "caption"
+	// FigureAdmonition renders the captioned figure in a `[!NOTE]` quote.
+	FigureAdmonition FigureMode = "admonition"
+)
+
+// DetailsMode controls how `<details>` elements are rendered.
+type DetailsMode string
+
+const (
+	// DetailsExpand renders the summary in bold followed by the content.
+	DetailsExpand DetailsMode = "expand"
+	// DetailsKeep keeps the `<details>` and `<summary>` tags around the
+	// content, which Markdown renderers pass through as HTML.
+	DetailsKeep DetailsMode = "keep"
+	// DetailsDrop leaves the details out.
+	DetailsDrop DetailsMode = "drop"
+)
+
+// AnchorMode controls how the ids of the headings are rendered.
+type AnchorMode string
+
+const (
+	// AnchorNone leaves the ids out.
+	AnchorNone AnchorMode = "none"
+	// AnchorPandoc appends the id to the heading, as in `## Usage {#usage}`.
+	AnchorPandoc AnchorMode = "pandoc"
+	// AnchorGFM starts the heading with an HTML anchor, as in
+	// `## <a id="usage"></a>Usage`.
+	AnchorGFM AnchorMode = "gfm"
+)
+
+// CiteMode controls where the source of the document is cited.
+type CiteMode string
+
+const (
+	// CiteNone leaves the source out.
+	CiteNone CiteMode = "none"
+	// CiteDocument cites the source once, at the end.
+	CiteDocument CiteMode = "document"
+	// CiteSection cites the source at the end of every section, with the
+	// anchor of its heading.
+	CiteSection CiteMode = "section"
+)
+
+// Options configures the rendering. The zero value renders figures with
+// their caption, expands the details and leaves the anchors and the source
+// out.
+type Options struct {
+	Figures FigureMode
+	Details DetailsMode
+	Anchors AnchorMode
+	Cite    CiteMode
+	// URL and FetchedAt are the source cited. Nothing is cited without a
+	// URL.
+	URL       string
+	FetchedAt time.Time
+}
+
+// Citation returns the line citing the URL, as in
+// `Source: https://example.com/#usage (fetched 2024-05-01)`.
+func Citation(url string, fetchedAt time.Time) string {
+	if fetchedAt.IsZero() {
+		return "Source: " + url
+	}
+	return "Source: " + url + " (fetched " + fetchedAt.UTC().Format("2006-01-02") + ")"
+}
+
+// renderer renders the nodes as Markdown, or as plain text without the
+// markup when plain is set.
+type renderer struct {
+	plain bool
+	o     Options
+	// ids counts the uses of the ids of the document and of the slugs given
+	// to the headings without one.
+	ids map[string]int
+	// section is the section being rendered when every section is cited.
+	section *section
+}
+
+// section is the anchor of the heading of a section, and whether anything
+// was rendered since that heading.
+type section struct {
+	anchor  string
+	pending bool
+}
+
+// Render returns the nodes as Markdown: headings, paragraphs, lists, quotes,
+// figures, code blocks, tables, links, images and emphasis. Other elements
+// keep only their text.
+func Render(nodes []*html.Node, o Options) string {
+	r := renderer{o: o, ids: map[string]int{}}
+	if o.Anchors == AnchorPandoc || o.Anchors == AnchorGFM {
+		collectIDs(nodes, r.ids)
+	}
+	return r.render(nodes)
+}
+
+// Text returns the text of the nodes, with a blank line between paragraphs
+// and the list items on their own line.
+func Text(nodes []*html.Node, o Options) string {
+	return renderer{plain: true, o: o}.render(nodes)
+}
+
+// render returns the blocks of the nodes, followed by the citation of their
+// source.
+func (r renderer) render(nodes []*html.Node) string {
+	if r.o.URL != "" && r.o.Cite == CiteSection {
+		r.section = &section{}
+	}
+
+	blocks := r.group(nodes)
+	if len(blocks) == 0 || r.o.URL == "" {
+		return strings.Join(blocks, "\n\n")
+	}
+
+	switch {
+	case r.section != nil && r.section.pending:
+		blocks = append(blocks, r.cite(r.section.anchor))
+	case r.o.Cite == CiteDocument:
+		blocks = append(blocks, r.cite(""))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// cite returns the citation of the source, pointing to the anchor if any.
+func (r renderer) cite(anchor string) string {
+	url := r.o.URL
+	if anchor != "" {
+		url, _, _ = strings.Cut(url, "#")
+		url += "#" + anchor
+	}
+	return Citation(url, r.o.FetchedAt)
+}
+
+// group returns the blocks of the nodes. Consecutive inline nodes make a
+// paragraph.
+func (r renderer) group(nodes []*html.Node) []string {
+	blocks := []string{}
+	var inline strings.Builder
+
+	flush := func() {
+		if paragraph := trimLines(inline.String()); paragraph != "" {
+			blocks = append(blocks, paragraph)
+			if r.section != nil {
+				r.section.pending = true
+			}
+		}
+		inline.Reset()
+	}
+
+	for _, n := range nodes {
+		if n.Type == html.DocumentNode || n.Type == html.ElementNode && blockElements[n.DataAtom] {
+			flush()
+			if r.section != nil && outline.Level(n) > 0 {
+				// The heading closes the section before it.
+				if r.section.pending {
+					blocks = append(blocks, r.cite(r.section.anchor))
+				}
+				r.section.anchor = outline.Anchor(n)
+				r.section.pending = false
+			}
+			blocks = append(blocks, r.block(n)...)
+		} else {
+			inline.WriteString(r.inline(n))
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+// block returns the blocks of a block element.
+func (r renderer) block(n *html.Node) []string {
+	if n.Type == html.DocumentNode {
+		return r.group(children(n))
+	}
+	blocks, ok := r.element(n)
+	if !ok {
+		return r.group(children(n))
+	}
+	if r.section != nil && len(blocks) > 0 && outline.Level(n) == 0 {
+		r.section.pending = true
+	}
+	return blocks
+}
+
+// element returns the blocks of the elements rendered as a whole, and false
+// for the ones only holding other blocks, like `<div>`.
+func (r renderer) element(n *html.Node) ([]string, bool) {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		heading := trimLines(strings.ReplaceAll(r.inlineChildren(n), "\n", " "))
+		if heading == "" {
+			return nil, true
+		}
+		if r.plain {
+			return []string{heading}, true
+		}
+		level := int(n.Data[1] - '0')
+		switch r.o.Anchors {
+		case AnchorPandoc:
+			heading += " {#" + r.anchor(n) + "}"
+		case AnchorGFM:
+			heading = `<a id="` + html.EscapeString(r.anchor(n)) + `"></a>` + heading
+		}
+		return []string{strings.Repeat("#", level) + " " + heading}, true
+	case atom.Pre:
+		code := strings.Trim(textContent(n), "\n")
+		if r.plain {
+			return []string{code}, true
+		}
+		return []string{"```\n" + code + "\n```"}, true
+	case atom.Ul, atom.Ol:
+		if list := r.list(n); list != "" {
+			return []string{list}, true
+		}
+		return nil, true
+	case atom.Blockquote:
+		if quote := r.quote(n, nil); quote != "" {
+			return []string{quote}, true
+		}
+		return nil, true
+	case atom.Figure:
+		return r.figure(n), true
+	case atom.Details:
+		return r.details(n), true
+	case atom.Hr:
+		if r.plain {
+			return nil, true
+		}
+		return []string{"---"}, true
+	case atom.Table:
+		if table := r.table(n); table != "" {
+			return []string{table}, true
+		}
+		return nil, true
+	}
+	return nil, false
+}
+
+// quote returns the blocks of the quote prefixed with `>`, nested quotes
+// getting one more level. A `<footer>` or `<cite>` child, or who when the
+// quote has none, becomes the attribution line closing the quote, linked to
+// the cite attribute if any.
+func (r renderer) quote(n *html.Node, who *html.Node) string {
+	nodes := []*html.Node{}
+	for _, c := range children(n) {
+		if a := attribution(c); a != nil {
+			who = a
+			continue
+		}
+		nodes = append(nodes, c)
+	}
+
+	author := ""
+	if who != nil {
+		author = trimLines(strings.ReplaceAll(r.inlineChildren(who), "\n", " "))
+		author = strings.TrimSpace(strings.TrimLeft(author, "—–-~ "))
+	}
+
+	blocks := r.group(nodes)
+	if author != "" {
+		if cite := attr(n, "cite"); cite != "" && !r.plain {
+			author = "[" + author + "](" + cite + ")"
+		}
+		blocks = append(blocks, "— "+author)
+	}
+
+	quote := strings.Join(blocks, "\n\n")
+	if quote == "" || r.plain {
+		return quote
+	}
+	return quoted(quote)
+}
+
+// figure returns the content of the figure followed by its caption. The
+// caption of a figure holding only a quote is the attribution of the quote.
+func (r renderer) figure(n *html.Node) []string {
+	nodes := []*html.Node{}
+	var caption *html.Node
+	for _, c := range children(n) {
+		switch {
+		case c.Type == html.ElementNode && c.DataAtom == atom.Figcaption:
+			caption = c
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) == "":
+		default:
+			nodes = append(nodes, c)
+		}
+	}
+
+	if caption == nil {
+		return r.group(nodes)
+	}
+
+	if len(nodes) == 1 && nodes[0].Type == html.ElementNode && nodes[0].DataAtom == atom.Blockquote {
+		if quote := r.quote(nodes[0], caption); quote != "" {
+			return []string{quote}
+		}
+		return nil
+	}
+
+	blocks := r.group(nodes)
+	text := trimLines(r.inlineChildren(caption))
+	if text == "" {
+		return blocks
+	}
+	if !r.plain {
+		text = "*" + strings.ReplaceAll(text, "\n", "*\n*") + "*"
+	}
+
+	// The caption stays in the block of the content so they aren't separated.
+	if len(blocks) == 0 {
+		blocks = []string{text}
+	} else {
+		blocks[len(blocks)-1] += "\n" + text
+	}
+
+	if r.plain || r.o.Figures != FigureAdmonition {
+		return blocks
+	}
+	return []string{quoted("[!NOTE]\n" + strings.Join(blocks, "\n\n"))}
+}
+
+// details returns the summary of the details followed by their content.
+func (r renderer) details(n *html.Node) []string {
+	if r.o.Details == DetailsDrop {
+		return nil
+	}
+
+	nodes := []*html.Node{}
+	var summary *html.Node
+	for _, c := range children(n) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Summary && summary == nil {
+			summary = c
+			continue
+		}
+		nodes = append(nodes, c)
+	}
+	blocks := r.group(nodes)
+
+	if !r.plain && r.o.Details == DetailsKeep {
+		open := "<details>"
+		if hasAttr(n, "open") {
+			open = "<details open>"
+		}
+		if summary != nil {
+			open += "\n<summary>" + html.EscapeString(trimLines(collapse(textContent(summary)))) + "</summary>"
+		}
+		return append(append([]string{open}, blocks...), "</details>")
+	}
+
+	if summary == nil {
+		return blocks
+	}
+	heading := trimLines(strings.ReplaceAll(r.inlineChildren(summary), "\n", " "))
+	if heading == "" {
+		return blocks
+	}
+	if !r.plain {
+		heading = "**" + heading + "**"
+	}
+	return append([]string{heading}, blocks...)
+}
+
+// quoted prefixes the lines of s with `>`.
+func quoted(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// attribution returns the node naming who is quoted, when n is a `<footer>`
+// or a `<cite>`, alone or in its own paragraph.
+func attribution(n *html.Node) *html.Node {
+	if n.Type != html.ElementNode {
+		return nil
+	}
+	switch n.DataAtom {
+	case atom.Footer, atom.Cite:
+		return n
+	case atom.P:
+		var cite *html.Node
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.ElementNode && c.DataAtom == atom.Cite && cite == nil:
+				cite = c
+			case c.Type == html.TextNode && strings.TrimLeft(strings.TrimSpace(c.Data), "—–-~ ") == "":
+			default:
+				return nil
+			}
+		}
+		if cite != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// anchor returns the id of the heading, or a slug of its text unique in the
+// document when it has none.
+func (r renderer) anchor(n *html.Node) string {
+	if id := outline.Anchor(n); id != "" {
+		return id
+	}
+
+	slug := Slug(outline.Text(n))
+	if slug == "" {
+		slug = "section"
+	}
+	id := slug
+	for r.ids[id] > 0 {
+		id = slug + "-" + strconv.Itoa(r.ids[slug])
+		r.ids[slug]++
+	}
+	r.ids[id]++
+	return id
+}
+
+// Slug returns the text in lower case with its spaces replaced by hyphens
+// and its punctuation removed, the way GitHub makes the anchors of the
+// headings.
+func Slug(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.Is(unicode.Mn, r), r == '-', r == '_':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// collectIDs counts the ids of the nodes and of their descendants.
+func collectIDs(nodes []*html.Node, ids map[string]int) {
+	for _, n := range nodes {
+		if n.Type == html.ElementNode {
+			if id := attr(n, "id"); id != "" {
+				ids[id]++
+			}
+		}
+		collectIDs(children(n), ids)
+	}
+}
+
+// list returns the items of the list, one per line, with their nested
+// blocks indented under them.
+func (r renderer) list(n *html.Node) string {
+	items := []string{}
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+
+	for _, c := range children(n) {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		indent := strings.Repeat(" ", len(marker))
+
+		lines := strings.Split(strings.Join(r.group(children(c)), "\n"), "\n")
+		for i, line := range lines {
+			if i > 0 && line != "" {
+				lines[i] = indent + line
+			}
+		}
+		items = append(items, marker+strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(items, "\n")
+}
+
+// table returns the rows of the table, the first one as the header. Plain
+// text separates the cells with tabs.
+func (r renderer) table(n *html.Node) string {
+	rows := [][]string{}
+	columns := 0
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Tr {
+			row := []string{}
+			for _, c := range children(n) {
+				if c.Type == html.ElementNode && (c.DataAtom == atom.Th || c.DataAtom == atom.Td) {
+					cell := trimLines(strings.ReplaceAll(r.inlineChildren(c), "\n", " "))
+					if !r.plain {
+						cell = strings.ReplaceAll(cell, "|", `\|`)
+					}
+					row = append(row, cell)
+				}
+			}
+			if len(row) > columns {
+				columns = len(row)
+			}
+			rows = append(rows, row)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	if len(rows) == 0 || columns == 0 {
+		return ""
+	}
+
+	lines := []string{}
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		if r.plain {
+			lines = append(lines, strings.TrimRight(strings.Join(row, "\t"), "\t"))
+			continue
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// inline returns the text of an inline node, with its markup.
+func (r renderer) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return collapse(n.Data)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if skippedElements[n.DataAtom] {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		if r.plain {
+			return "\n"
+		}
+		return "\\\n"
+	case atom.Img:
+		alt := attr(n, "alt")
+		if r.plain || attr(n, "src") == "" {
+			return alt
+		}
+		return "![" + alt + "](" + attr(n, "src") + ")"
+	case atom.Code, atom.Kbd, atom.Samp:
+		code := collapse(textContent(n))
+		if r.plain || strings.TrimSpace(code) == "" {
+			return code
+		}
+		return "`" + strings.TrimSpace(code) + "`"
+	}
+
+	content := r.inlineChildren(n)
+	if r.plain || strings.TrimSpace(content) == "" {
+		return content
+	}
+
+	switch n.DataAtom {
+	case atom.A:
+		if href := attr(n, "href"); href != "" {
+			return "[" + strings.TrimSpace(content) + "](" + href + ")"
+		}
+	case atom.Strong, atom.B:
+		return "**" + strings.TrimSpace(content) + "**"
+	case atom.Em, atom.I, atom.Cite:
+		return "*" + strings.TrimSpace(content) + "*"
+	case atom.Del, atom.S:
+		return "~~" + strings.TrimSpace(content) + "~~"
+	}
+	return content
+}
+
+// inlineChildren returns the text of the children of the node, flattening
+// the blocks they may have.
+func (r renderer) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockElements[c.DataAtom] {
+			b.WriteString(" " + r.inlineChildren(c) + " ")
+		} else {
+			b.WriteString(r.inline(c))
+		}
+	}
+	return b.String()
+}
+
+func children(n *html.Node) []*html.Node {
+	nodes := []*html.Node{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && skippedElements[c.DataAtom] {
+			continue
+		}
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// collapse replaces the runs of whitespace with a single space, the way
+// browsers render text.
+func collapse(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		b.WriteRune(r)
+		space = false
+	}
+	return b.String()
+}
+
+// trimLines trims the spaces around every line of the text, and the blank
+// lines around it. The spaces between CJK characters go away.
+func trimLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = text.JoinCJK(strings.Join(strings.Fields(line), " "))
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
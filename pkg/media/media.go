@@ -0,0 +1,277 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Formats supported by Write.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+)
+
+// Kinds of media elements.
+const (
+	Video = "video"
+	Audio = "audio"
+)
+
+// Element is a `<video>` or `<audio>` element of a document.
+type Element struct {
+	Kind string `json:"kind"`
+	// Title is the `title` or `aria-label` of the element, if any.
+	Title   string   `json:"title,omitempty"`
+	Sources []Source `json:"sources"`
+	Poster  string   `json:"poster,omitempty"`
+	// Duration is the ISO 8601 duration of the schema.org object the element
+	// belongs to, or the one of its `data-duration` attribute. Pages don't
+	// tell it otherwise without loading the media.
+	Duration string  `json:"duration,omitempty"`
+	Tracks   []Track `json:"tracks"`
+}
+
+// Source is a file the element can play.
+type Source struct {
+	URL  string `json:"url"`
+	Type string `json:"type,omitempty"`
+}
+
+// Track is a `<track>` of captions, subtitles, descriptions or chapters.
+type Track struct {
+	URL      string `json:"url"`
+	Kind     string `json:"kind"`
+	Language string `json:"language,omitempty"`
+	Label    string `json:"label,omitempty"`
+}
+
+// Elements returns the media elements found in the nodes, in document order.
+// Their URLs are resolved against the base URL when it's known.
+func Elements(nodes []*html.Node, base *url.URL) []Element {
+	elements := []Element{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Video || n.DataAtom == atom.Audio) {
+			elements = append(elements, element(n, base))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	for _, n := range nodes {
+		walk(n)
+	}
+
+	return elements
+}
+
+func element(n *html.Node, base *url.URL) Element {
+	e := Element{
+		Kind:     n.Data,
+		Title:    attr(n, "title"),
+		Sources:  []Source{},
+		Poster:   resolve(base, attr(n, "poster")),
+		Duration: duration(n),
+		Tracks:   []Track{},
+	}
+	if e.Title == "" {
+		e.Title = attr(n, "aria-label")
+	}
+
+	if src := attr(n, "src"); src != "" {
+		e.Sources = append(e.Sources, Source{URL: resolve(base, src)})
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Source:
+			if src := attr(c, "src"); src != "" {
+				e.Sources = append(e.Sources, Source{URL: resolve(base, src), Type: attr(c, "type")})
+			}
+		case atom.Track:
+			if src := attr(c, "src"); src != "" {
+				kind := attr(c, "kind")
+				if kind == "" {
+					kind = "subtitles"
+				}
+				e.Tracks = append(e.Tracks, Track{
+					URL:      resolve(base, src),
+					Kind:     kind,
+					Language: attr(c, "srclang"),
+					Label:    attr(c, "label"),
+				})
+			}
+		}
+	}
+
+	return e
+}
+
+// duration returns the `data-duration` of the element, or the `duration`
+// property of the closest schema.org item around it.
+func duration(n *html.Node) string {
+	if d := attr(n, "data-duration"); d != "" {
+		return d
+	}
+
+	for scope := n; scope != nil; scope = scope.Parent {
+		if scope.Type != html.ElementNode || !hasAttr(scope, "itemscope") {
+			continue
+		}
+		if d := itemprop(scope, "duration"); d != "" {
+			return d
+		}
+	}
+	return ""
+}
+
+// itemprop returns the value of the first property of the item with the
+// name, without entering nested items.
+func itemprop(scope *html.Node, name string) string {
+	for c := scope.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if attr(c, "itemprop") == name {
+			if content := attr(c, "content"); content != "" {
+				return content
+			}
+			if datetime := attr(c, "datetime"); datetime != "" {
+				return datetime
+			}
+		}
+		if hasAttr(c, "itemscope") {
+			continue
+		}
+		if value := itemprop(c, name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Write prints the media elements in the given format. Text lists their
+// URLs, markdown links to them and JSON is a list of elements.
+func Write(w io.Writer, elements []Element, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(elements)
+	case FormatText, FormatMarkdown:
+	default:
+		return fmt.Errorf("unsupported media format: %s", format)
+	}
+
+	for _, e := range elements {
+		label := e.Kind
+		if e.Title != "" {
+			label += ": " + e.Title
+		}
+		if e.Duration != "" {
+			label += " (" + e.Duration + ")"
+		}
+
+		lines := []string{}
+		if format == FormatText {
+			lines = append(lines, label)
+			for _, s := range e.Sources {
+				lines = append(lines, "  "+s.URL)
+			}
+			if e.Poster != "" {
+				lines = append(lines, "  poster "+e.Poster)
+			}
+			for _, t := range e.Tracks {
+				lines = append(lines, fmt.Sprintf("  %s %s", trackLabel(t), t.URL))
+			}
+		} else {
+			if len(e.Sources) > 0 {
+				lines = append(lines, fmt.Sprintf("- [%s](%s)", label, e.Sources[0].URL))
+			} else {
+				lines = append(lines, "- "+label)
+			}
+			for _, s := range e.Sources[min(1, len(e.Sources)):] {
+				lines = append(lines, fmt.Sprintf("  - [%s](%s)", sourceLabel(s), s.URL))
+			}
+			if e.Poster != "" {
+				lines = append(lines, fmt.Sprintf("  - [poster](%s)", e.Poster))
+			}
+			for _, t := range e.Tracks {
+				lines = append(lines, fmt.Sprintf("  - [%s](%s)", trackLabel(t), t.URL))
+			}
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceLabel names an alternative source by its type, or as a plain
+// source when it has none.
+func sourceLabel(s Source) string {
+	if s.Type != "" {
+		return s.Type
+	}
+	return "source"
+}
+
+// trackLabel names a track by its kind and language, like `captions (en)`.
+func trackLabel(t Track) string {
+	label := t.Kind
+	switch {
+	case t.Label != "" && t.Language != "":
+		label += fmt.Sprintf(" (%s, %s)", t.Label, t.Language)
+	case t.Label != "":
+		label += " (" + t.Label + ")"
+	case t.Language != "":
+		label += " (" + t.Language + ")"
+	}
+	return label
+}
+
+// resolve returns the reference resolved against the base URL, or as is
+// when the base is unknown or the reference invalid.
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if base == nil || ref == "" {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
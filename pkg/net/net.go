@@ -1,9 +1,14 @@
 package net
 
-import "net"
+import (
+	"net"
+	"strconv"
+)
 
-func GetRandomUnusedPort() (int, error) {
-	listener, err := net.Listen("tcp", ":0")
+// GetRandomUnusedPort returns a port the OS considers free on the host.
+// Another process may take it before it gets used.
+func GetRandomUnusedPort(host string) (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
 	if err != nil {
 		return 0, err
 	}
@@ -12,3 +17,13 @@ func GetRandomUnusedPort() (int, error) {
 	addr := listener.Addr().(*net.TCPAddr)
 	return addr.Port, nil
 }
+
+// PortInUse reports whether something is listening on the port of the host.
+func PortInUse(host string, port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return true
+	}
+	listener.Close()
+	return false
+}
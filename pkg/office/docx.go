@@ -0,0 +1,207 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	wordNS         = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	relationshipNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+// run is the text of a `<w:r>` element and its formatting.
+type run struct {
+	bold, italic bool
+	text         strings.Builder
+}
+
+// convertDOCX converts `word/document.xml` to an HTML body.
+func convertDOCX(archive *zip.Reader) (*html.Node, error) {
+	data, err := read(archive, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	links := relationships(archive)
+
+	body := element(atom.Body)
+	stack := []*html.Node{body}
+	var r *run
+	inText, inProperties := false, false
+
+	// flush appends the text read so far of the run to the current element.
+	flush := func() {
+		if r == nil || r.text.Len() == 0 {
+			return
+		}
+		n := &html.Node{Type: html.TextNode, Data: r.text.String()}
+		if r.italic {
+			em := element(atom.Em)
+			em.AppendChild(n)
+			n = em
+		}
+		if r.bold {
+			strong := element(atom.Strong)
+			strong.AppendChild(n)
+			n = strong
+		}
+		stack[len(stack)-1].AppendChild(n)
+		r.text.Reset()
+	}
+
+	push := func(a atom.Atom) *html.Node {
+		n := element(a)
+		stack[len(stack)-1].AppendChild(n)
+		stack = append(stack, n)
+		return n
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				push(atom.P)
+			case "pPr":
+				inProperties = true
+			case "pStyle":
+				if level := headingLevel(attr(t, wordNS, "val")); level > 0 {
+					p := stack[len(stack)-1]
+					p.DataAtom = []atom.Atom{atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6}[level-1]
+					p.Data = p.DataAtom.String()
+				}
+			case "numPr":
+				if p := stack[len(stack)-1]; inProperties && p.DataAtom == atom.P {
+					p.DataAtom, p.Data = atom.Li, "li"
+				}
+			case "r":
+				r = &run{}
+			case "b", "i":
+				if r != nil {
+					on := attr(t, wordNS, "val")
+					enabled := on == "" || on == "1" || on == "true" || on == "on"
+					if t.Name.Local == "b" {
+						r.bold = enabled
+					} else {
+						r.italic = enabled
+					}
+				}
+			case "t":
+				inText = true
+			case "tab":
+				if r != nil {
+					r.text.WriteString("\t")
+				}
+			case "br":
+				flush()
+				stack[len(stack)-1].AppendChild(element(atom.Br))
+			case "hyperlink":
+				a := push(atom.A)
+				if href, ok := links[attr(t, relationshipNS, "id")]; ok {
+					a.Attr = append(a.Attr, html.Attribute{Key: "href", Val: href})
+				} else if anchor := attr(t, wordNS, "anchor"); anchor != "" {
+					a.Attr = append(a.Attr, html.Attribute{Key: "href", Val: "#" + anchor})
+				}
+			case "tbl":
+				push(atom.Table)
+			case "tr":
+				push(atom.Tr)
+			case "tc":
+				push(atom.Td)
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "p", "hyperlink", "tbl", "tr", "tc":
+				flush()
+				stack = stack[:len(stack)-1]
+			case "pPr":
+				inProperties = false
+			case "r":
+				flush()
+				r = nil
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText && r != nil {
+				r.text.Write(t)
+			}
+		}
+	}
+
+	return body, nil
+}
+
+// headingLevel returns the heading level of a paragraph style, like 2 for
+// `Heading2`, 1 for `Title` and 0 for other styles.
+func headingLevel(style string) int {
+	style = strings.ToLower(style)
+	if style == "title" {
+		return 1
+	}
+	if level, ok := strings.CutPrefix(style, "heading"); ok && len(level) == 1 && level[0] >= '1' && level[0] <= '6' {
+		return int(level[0] - '0')
+	}
+	return 0
+}
+
+// relationships returns the targets of the external links of the document,
+// by their ID.
+func relationships(archive *zip.Reader) map[string]string {
+	links := map[string]string{}
+
+	data, err := read(archive, "word/_rels/document.xml.rels")
+	if err != nil {
+		return links
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID         string `xml:"Id,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &rels); err != nil {
+		return links
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.TargetMode == "External" {
+			links[rel.ID] = rel.Target
+		}
+	}
+	return links
+}
+
+// attr returns the value of the attribute of the element, or an empty
+// string.
+func attr(t xml.StartElement, space, local string) string {
+	for _, a := range t.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	officeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	textNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+	tableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	xlinkNS  = "http://www.w3.org/1999/xlink"
+)
+
+// convertODT converts the text of `content.xml` to an HTML body.
+func convertODT(archive *zip.Reader) (*html.Node, error) {
+	data, err := read(archive, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	body := element(atom.Body)
+	stack := []*html.Node{body}
+	// skipped counts the open elements whose content is left out, like
+	// annotations and tracked changes.
+	inText, skipped := false, 0
+
+	push := func(a atom.Atom) *html.Node {
+		n := element(a)
+		stack[len(stack)-1].AppendChild(n)
+		stack = append(stack, n)
+		return n
+	}
+	appendText := func(s string) {
+		parent := stack[len(stack)-1]
+		if last := parent.LastChild; last != nil && last.Type == html.TextNode {
+			last.Data += s
+			return
+		}
+		parent.AppendChild(&html.Node{Type: html.TextNode, Data: s})
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == officeNS && t.Name.Local == "text" {
+				inText = true
+				continue
+			}
+			if !inText {
+				continue
+			}
+			if skipped > 0 || isSkipped(t.Name) {
+				skipped++
+				continue
+			}
+
+			switch t.Name {
+			case xml.Name{Space: textNS, Local: "h"}:
+				level, _ := strconv.Atoi(attr(t, textNS, "outline-level"))
+				level = min(max(level, 1), 6)
+				push([]atom.Atom{atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6}[level-1])
+			case xml.Name{Space: textNS, Local: "p"}:
+				push(atom.P)
+			case xml.Name{Space: textNS, Local: "list"}:
+				push(atom.Ul)
+			case xml.Name{Space: textNS, Local: "list-item"}:
+				push(atom.Li)
+			case xml.Name{Space: textNS, Local: "a"}:
+				a := push(atom.A)
+				if href := attr(t, xlinkNS, "href"); href != "" {
+					a.Attr = append(a.Attr, html.Attribute{Key: "href", Val: href})
+				}
+			case xml.Name{Space: textNS, Local: "s"}:
+				count, err := strconv.Atoi(attr(t, textNS, "c"))
+				if err != nil || count < 1 {
+					count = 1
+				}
+				appendText(strings.Repeat(" ", count))
+			case xml.Name{Space: textNS, Local: "tab"}:
+				appendText("\t")
+			case xml.Name{Space: textNS, Local: "line-break"}:
+				stack[len(stack)-1].AppendChild(element(atom.Br))
+			case xml.Name{Space: tableNS, Local: "table"}:
+				push(atom.Table)
+			case xml.Name{Space: tableNS, Local: "table-row"}:
+				push(atom.Tr)
+			case xml.Name{Space: tableNS, Local: "table-cell"}:
+				push(atom.Td)
+			}
+		case xml.EndElement:
+			if t.Name.Space == officeNS && t.Name.Local == "text" {
+				inText = false
+				continue
+			}
+			if !inText {
+				continue
+			}
+			if skipped > 0 {
+				skipped--
+				continue
+			}
+
+			switch t.Name {
+			case xml.Name{Space: textNS, Local: "h"},
+				xml.Name{Space: textNS, Local: "p"},
+				xml.Name{Space: textNS, Local: "list"},
+				xml.Name{Space: textNS, Local: "list-item"},
+				xml.Name{Space: textNS, Local: "a"},
+				xml.Name{Space: tableNS, Local: "table"},
+				xml.Name{Space: tableNS, Local: "table-row"},
+				xml.Name{Space: tableNS, Local: "table-cell"}:
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if !inText || skipped > 0 || len(stack) == 1 {
+				continue
+			}
+			// Only the whitespace of the text is kept, not the one between
+			// the rows and the cells of tables or the items of lists.
+			switch stack[len(stack)-1].DataAtom {
+			case atom.Table, atom.Tr, atom.Ul:
+				if strings.TrimSpace(string(t)) == "" {
+					continue
+				}
+			}
+			appendText(string(t))
+		}
+	}
+
+	return body, nil
+}
+
+// isSkipped tells whether the content of the element is left out of the
+// document.
+func isSkipped(name xml.Name) bool {
+	switch name {
+	case xml.Name{Space: officeNS, Local: "annotation"},
+		xml.Name{Space: textNS, Local: "tracked-changes"},
+		xml.Name{Space: textNS, Local: "note-citation"},
+		xml.Name{Space: textNS, Local: "sequence-decls"}:
+		return true
+	}
+	return false
+}
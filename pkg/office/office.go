@@ -0,0 +1,166 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Kinds of office documents.
+const (
+	DOCX = "docx"
+	ODT  = "odt"
+)
+
+const (
+	docxType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	odtType  = "application/vnd.oasis.opendocument.text"
+)
+
+// IsZip tells whether the first bytes of a document are the ones of a ZIP
+// archive, which office documents are.
+func IsZip(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("PK\x03\x04"))
+}
+
+// Detect returns the kind of the office document from its Content-Type, or
+// from the files of the archive when the type is unknown. It returns an
+// empty string for other documents.
+func Detect(contentType string, body []byte) string {
+	switch mediaType, _, _ := mime.ParseMediaType(contentType); mediaType {
+	case docxType:
+		return DOCX
+	case odtType:
+		return ODT
+	}
+
+	if !IsZip(body) {
+		return ""
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return ""
+	}
+	if _, err := archive.Open("word/document.xml"); err == nil {
+		return DOCX
+	}
+	if data, err := read(archive, "mimetype"); err == nil && strings.TrimSpace(string(data)) == odtType {
+		return ODT
+	}
+	return ""
+}
+
+// ToHTML converts the office document to an HTML document with its title,
+// headings, paragraphs, lists, links and tables, so it goes through the same
+// selectors and output as web pages. Styles aren't kept.
+func ToHTML(body []byte, kind string) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	var title string
+	var content *html.Node
+	switch kind {
+	case DOCX:
+		title = documentTitle(archive, "docProps/core.xml")
+		content, err = convertDOCX(archive)
+	case ODT:
+		title = documentTitle(archive, "meta.xml")
+		content, err = convertODT(archive)
+	default:
+		return nil, fmt.Errorf("unsupported office document: %s", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	document := element(atom.Html)
+	head := element(atom.Head)
+	document.AppendChild(head)
+	if title != "" {
+		t := element(atom.Title)
+		t.AppendChild(&html.Node{Type: html.TextNode, Data: title})
+		head.AppendChild(t)
+	}
+	document.AppendChild(content)
+	groupListItems(content)
+
+	var b bytes.Buffer
+	b.WriteString("<!DOCTYPE html>\n")
+	if err := html.Render(&b, document); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// documentTitle returns the `dc:title` of the metadata file, if any.
+func documentTitle(archive *zip.Reader, name string) string {
+	data, err := read(archive, name)
+	if err != nil {
+		return ""
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	inTitle := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			inTitle = t.Name.Space == "http://purl.org/dc/elements/1.1/" && t.Name.Local == "title"
+		case xml.CharData:
+			if inTitle {
+				return strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			inTitle = false
+		}
+	}
+}
+
+// read returns the content of a file of the archive.
+func read(archive *zip.Reader, name string) ([]byte, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// element returns a new HTML element.
+func element(a atom.Atom) *html.Node {
+	return &html.Node{Type: html.ElementNode, DataAtom: a, Data: a.String()}
+}
+
+// groupListItems wraps the consecutive `<li>` elements that aren't in a list
+// into `<ul>` elements.
+func groupListItems(n *html.Node) {
+	var list *html.Node
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.DataAtom == atom.Li && n.DataAtom != atom.Ul && n.DataAtom != atom.Ol {
+			if list == nil {
+				list = element(atom.Ul)
+				n.InsertBefore(list, c)
+			}
+			n.RemoveChild(c)
+			list.AppendChild(c)
+		} else {
+			list = nil
+			groupListItems(c)
+		}
+		c = next
+	}
+}
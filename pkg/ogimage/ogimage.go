@@ -0,0 +1,152 @@
+package ogimage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// keys are the `<meta>` tags naming the image of a page, by preference.
+var keys = []string{"og:image:secure_url", "og:image:url", "og:image", "twitter:image", "twitter:image:src"}
+
+// maxSize is the size of the largest image downloaded.
+const maxSize = 20 << 20
+
+// URL returns the absolute URL of the OpenGraph image of a page from its
+// metadata, falling back to the Twitter card image. It returns an empty
+// string when the page has none, or when it's relative and the page URL
+// is unknown.
+func URL(metadata map[string]string, pageURL string) string {
+	for _, key := range keys {
+		ref := strings.TrimSpace(metadata[key])
+		if ref == "" {
+			continue
+		}
+
+		u, err := url.Parse(ref)
+		if err != nil {
+			continue
+		}
+		if u.IsAbs() {
+			return u.String()
+		}
+
+		base, err := url.Parse(pageURL)
+		if err != nil || !base.IsAbs() {
+			continue
+		}
+		return base.ResolveReference(u).String()
+	}
+	return ""
+}
+
+// Download saves the image in the directory and returns its path. Files are
+// named after a hash of the image URL, so pages sharing an image share the
+// file and images already downloaded aren't fetched again.
+func Download(ctx context.Context, client *http.Client, imageURL, dir string) (string, error) {
+	sum := sha256.Sum256([]byte(imageURL))
+	name := hex.EncodeToString(sum[:8])
+
+	if matches, _ := filepath.Glob(filepath.Join(dir, name+".*")); len(matches) > 0 {
+		return matches[0], nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("%s: %s", imageURL, response.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxSize {
+		return "", fmt.Errorf("%s: larger than %d MB", imageURL, maxSize>>20)
+	}
+
+	// Servers often send images as application/octet-stream, so the content
+	// decides when the type isn't an image one.
+	contentType := response.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); !strings.HasPrefix(mediaType, "image/") {
+		contentType = http.DetectContentType(body)
+		if !strings.HasPrefix(contentType, "image/") && !isSVG(body) {
+			return "", fmt.Errorf("%s: not an image: %s", imageURL, contentType)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	file := filepath.Join(dir, name+extension(contentType, imageURL, body))
+	if err := os.WriteFile(file, body, 0o644); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// extension returns the file extension of the image, from its Content-Type,
+// its URL or its content, in that order.
+func extension(contentType, imageURL string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if ext := imageExtension(mediaType); ext != "" {
+		return ext
+	}
+	if u, err := url.Parse(imageURL); err == nil {
+		if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && len(ext) <= 5 {
+			return ext
+		}
+	}
+	if isSVG(body) {
+		return ".svg"
+	}
+	return ".img"
+}
+
+// isSVG tells whether the content is an SVG image, which
+// http.DetectContentType sees as text.
+func isSVG(body []byte) bool {
+	head := strings.ToLower(string(body[:min(len(body), 512)]))
+	return strings.Contains(head, "<svg")
+}
+
+// imageExtension returns the usual extension of an image type, which
+// mime.ExtensionsByType doesn't, like `.jpg` rather than `.jfif`.
+func imageExtension(mediaType string) string {
+	switch mediaType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	case "image/avif":
+		return ".avif"
+	case "image/x-icon", "image/vnd.microsoft.icon":
+		return ".ico"
+	}
+	return ""
+}
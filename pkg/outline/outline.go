@@ -0,0 +1,196 @@
+package outline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/cloudbridgeuy/puper/pkg/text"
+)
+
+// Level returns the level of a `<h1>` to `<h6>` element, or 0 if the node
+// isn't a heading.
+func Level(n *html.Node) int {
+	if n.Type != html.ElementNode {
+		return 0
+	}
+	switch n.DataAtom {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+// Text returns the text of the node with its whitespace collapsed, and
+// removed between CJK characters.
+func Text(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return text.JoinCJK(strings.Join(strings.Fields(b.String()), " "))
+}
+
+// Sections returns the sections of the nodes whose heading matches the
+// pattern. A section is the heading followed by its siblings up to the next
+// heading of the same or a higher level. Nested matching sections are only
+// returned once, as part of their parent.
+func Sections(nodes []*html.Node, pattern *regexp.Regexp) []*html.Node {
+	sections := []*html.Node{}
+	included := map[*html.Node]bool{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if included[n] {
+			return
+		}
+
+		if level := Level(n); level > 0 && pattern.MatchString(Text(n)) {
+			for s := n; s != nil; s = s.NextSibling {
+				if s != n && closes(s, level) {
+					break
+				}
+				sections = append(sections, s)
+				included[s] = true
+			}
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	for _, n := range nodes {
+		walk(n)
+	}
+
+	return sections
+}
+
+// closes reports whether the node ends a section of the given level, either
+// because it is a heading of the same or a higher level, or because it wraps
+// one.
+func closes(n *html.Node, level int) bool {
+	if l := Level(n); l > 0 {
+		return l <= level
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if closes(c, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Formats supported by Write.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+)
+
+// Heading is an entry of the outline of a document.
+type Heading struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor,omitempty"`
+}
+
+// Headings returns the headings found in the nodes, in document order.
+func Headings(nodes []*html.Node) []Heading {
+	headings := []Heading{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if level := Level(n); level > 0 {
+			headings = append(headings, Heading{Level: level, Text: Text(n), Anchor: Anchor(n)})
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	for _, n := range nodes {
+		walk(n)
+	}
+
+	return headings
+}
+
+// Write prints the headings in the given format. Text and markdown are
+// indented by level, JSON is a list of headings.
+func Write(w io.Writer, headings []Heading, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(headings)
+	case FormatText, FormatMarkdown:
+	default:
+		return fmt.Errorf("unsupported outline format: %s", format)
+	}
+
+	for _, h := range headings {
+		indent := strings.Repeat("  ", h.Level-1)
+
+		var line string
+		switch {
+		case format == FormatText && h.Anchor != "":
+			line = fmt.Sprintf("%s%s (#%s)", indent, h.Text, h.Anchor)
+		case format == FormatText:
+			line = indent + h.Text
+		case h.Anchor != "":
+			line = fmt.Sprintf("%s- [%s](#%s)", indent, h.Text, h.Anchor)
+		default:
+			line = fmt.Sprintf("%s- %s", indent, h.Text)
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Anchor returns the id of the heading, or of the first element inside it
+// that has one, like `<h2><a id="usage"></a>Usage</h2>`.
+func Anchor(n *html.Node) string {
+	if n.Type == html.ElementNode {
+		for _, a := range n.Attr {
+			if a.Key == "id" || (a.Key == "name" && n.DataAtom == atom.A) {
+				return a.Val
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if id := Anchor(c); id != "" {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// Digest passes the writes through, hashing them, to describe each document
+// printed to a shared output.
+type Digest struct {
+	w   io.Writer
+	sum hash.Hash
+}
+
+// NewDigest returns a digest writing to w.
+func NewDigest(w io.Writer) *Digest {
+	return &Digest{w: w, sum: sha256.New()}
+}
+
+// Write writes to the underlying writer.
+func (d *Digest) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	d.sum.Write(p[:n])
+	return n, err
+}
+
+// Reset starts a new document.
+func (d *Digest) Reset() {
+	d.sum.Reset()
+}
+
+// Sum returns the SHA-256 of what was written since the last Reset, like
+// `sha256:3a7b…`.
+func (d *Digest) Sum() string {
+	return "sha256:" + hex.EncodeToString(d.sum.Sum(nil))
+}
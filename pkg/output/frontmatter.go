@@ -0,0 +1,34 @@
+package output
+
+import (
+	"bytes"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Frontmatter is the YAML block written before the content of a document,
+// for the tools ingesting it.
+type Frontmatter struct {
+	Title   string `yaml:"title,omitempty"`
+	URL     string `yaml:"url,omitempty"`
+	OGImage string `yaml:"og-image,omitempty"`
+	Favicon string `yaml:"favicon,omitempty"`
+}
+
+// Write writes the frontmatter between `---` lines.
+func (f Frontmatter) Write(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("---\n")
+	if f != (Frontmatter{}) {
+		data, err := yaml.Marshal(f)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+	}
+	b.WriteString("---\n")
+
+	_, err := b.WriteTo(w)
+	return err
+}
@@ -0,0 +1,162 @@
+package output
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Mode controls what happens when the output file already exists.
+type Mode string
+
+const (
+	// ModeOverwrite replaces the existing file.
+	ModeOverwrite Mode = "overwrite"
+	// ModeAppend adds the output at the end of the existing file.
+	ModeAppend Mode = "append"
+	// ModeSkip leaves the existing file untouched and skips the run.
+	ModeSkip Mode = "skip"
+)
+
+// ParseMode validates an output mode.
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(value); mode {
+	case ModeOverwrite, ModeAppend, ModeSkip:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported output mode: %s", value)
+	}
+}
+
+// Exists reports whether there is a file at path.
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// File is an output file written atomically. Writes go to a temporary file
+// next to the target, which only replaces it on Commit, so a failed run never
+// leaves a truncated file behind. Commit leaves the target untouched when the
+// content didn't change.
+type File struct {
+	path      string
+	perm      fs.FileMode
+	tmp       *os.File
+	sum       hash.Hash
+	existing  []byte
+	unchanged bool
+	done      bool
+}
+
+// Open prepares the atomic write of the file at path. In append mode the
+// current content of the file is copied first.
+func Open(path string, mode Mode) (*File, error) {
+	f := &File{path: path, perm: 0o644, sum: sha256.New()}
+
+	existing, err := os.Open(path)
+	switch {
+	case err == nil:
+		defer existing.Close()
+		if info, err := existing.Stat(); err == nil {
+			f.perm = info.Mode().Perm()
+		}
+
+		sum := sha256.New()
+		if _, err := io.Copy(sum, existing); err != nil {
+			return nil, err
+		}
+		f.existing = sum.Sum(nil)
+
+		if _, err := existing.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	case os.IsNotExist(err):
+		existing = nil
+	default:
+		return nil, err
+	}
+
+	f.tmp, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == ModeAppend && existing != nil {
+		if _, err := io.Copy(f, existing); err != nil {
+			f.Discard()
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Write writes to the temporary file.
+func (f *File) Write(p []byte) (int, error) {
+	n, err := f.tmp.Write(p)
+	f.sum.Write(p[:n])
+	return n, err
+}
+
+// Path returns the path of the target file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Unchanged reports whether Commit left the target untouched because its
+// content was already the same.
+func (f *File) Unchanged() bool {
+	return f.unchanged
+}
+
+// Commit replaces the target file with everything written so far, unless
+// its content is the same.
+func (f *File) Commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	if f.existing != nil && bytes.Equal(f.existing, f.sum.Sum(nil)) {
+		f.unchanged = true
+		f.cleanup()
+		return nil
+	}
+
+	if err := f.tmp.Chmod(f.perm); err != nil {
+		f.cleanup()
+		return err
+	}
+
+	if err := f.tmp.Close(); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(f.tmp.Name(), f.path); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Discard drops everything written so far, leaving the target untouched. It
+// does nothing after a Commit.
+func (f *File) Discard() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.cleanup()
+}
+
+func (f *File) cleanup() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
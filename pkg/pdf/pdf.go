@@ -0,0 +1,365 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+
+	ptext "github.com/cloudbridgeuy/puper/pkg/text"
+)
+
+// Formats supported by Write.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatLayout   = "layout"
+)
+
+// Line is a line of text of a page.
+type Line struct {
+	Text string
+	// FontSize is the size of the first character of the line, in points.
+	FontSize float64
+	// X and Y are the position of the start of the line, in points from the
+	// bottom left corner of the page.
+	X, Y float64
+
+	texts []pdf.Text
+}
+
+// IsPDF tells whether the document is a PDF from its Content-Type, or from
+// its first bytes when the type is unknown.
+func IsPDF(contentType string, head []byte) bool {
+	if strings.HasPrefix(contentType, "application/pdf") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte("%PDF-"))
+}
+
+// Pages returns the lines of text of every page of the PDF document.
+func Pages(body []byte) (pages [][]Line, err error) {
+	// The reader panics on malformed documents, from the page tree to the
+	// content streams.
+	current := 0
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("malformed PDF document: %v", r)
+			if current > 0 {
+				err = fmt.Errorf("page %d: %w", current, err)
+			}
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	pages = [][]Line{}
+	for i, page := range pageTree(reader.Trailer().Key("Root").Key("Pages"), 0) {
+		current = i + 1
+		pages = append(pages, lines(page))
+	}
+	return pages, nil
+}
+
+// maxTreeDepth bounds the walk of the page tree, which malformed documents
+// can make cyclic.
+const maxTreeDepth = 64
+
+// pageTree returns the pages of the page tree, in order. The reader's own
+// lookup trusts the page counts of the tree and loops forever when a
+// document has fewer pages than it claims.
+func pageTree(node pdf.Value, depth int) []pdf.Page {
+	switch node.Key("Type").Name() {
+	case "Page":
+		return []pdf.Page{{V: node}}
+	case "Pages":
+		if depth >= maxTreeDepth {
+			return nil
+		}
+		pages := []pdf.Page{}
+		kids := node.Key("Kids")
+		for i := 0; i < kids.Len(); i++ {
+			pages = append(pages, pageTree(kids.Index(i), depth+1)...)
+		}
+		return pages
+	}
+	return nil
+}
+
+// lines groups the characters of the page into lines. PDFs position the
+// characters instead of separating the words, so a space is added where the
+// gap between two characters is wider than a fraction of the font size.
+func lines(page pdf.Page) []Line {
+	result := []Line{}
+	var b strings.Builder
+	var line Line
+	var previous *pdf.Text
+
+	flush := func() {
+		if text := ptext.JoinCJK(strings.Join(strings.Fields(b.String()), " ")); text != "" {
+			line.Text = text
+			result = append(result, line)
+		}
+		b.Reset()
+		previous = nil
+	}
+
+	texts := page.Content().Text
+	for i := range texts {
+		text := &texts[i]
+		if text.S == "\n" {
+			flush()
+			continue
+		}
+
+		if previous != nil {
+			if math.Abs(text.Y-previous.Y) > previous.FontSize/2 {
+				flush()
+			} else if text.X-(previous.X+previous.W) > previous.FontSize*0.15 {
+				b.WriteString(" ")
+			}
+		}
+		if previous == nil {
+			line = Line{FontSize: text.FontSize, X: text.X, Y: text.Y}
+		}
+
+		b.WriteString(text.S)
+		line.texts = append(line.texts, *text)
+		previous = text
+	}
+	flush()
+
+	return result
+}
+
+// Write writes the text of the PDF document in the format:
+//
+//   - text: one line per line of text and a blank line between pages.
+//   - markdown: paragraphs, with the lines set in a larger font than the body
+//     as headings and a comment marking the start of every page.
+//   - layout: the lines placed where they are on the page, keeping columns
+//     and indentation.
+func Write(w io.Writer, body []byte, format string) error {
+	pages, err := Pages(body)
+	if err != nil {
+		return err
+	}
+
+	text, err := Render(pages, format)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, text)
+	return err
+}
+
+// Render returns the text of the pages in one of the formats of Write, for
+// the callers rendering the same document in several formats.
+func Render(pages [][]Line, format string) (string, error) {
+	var b bytes.Buffer
+	switch format {
+	case FormatText:
+		writeText(&b, pages)
+	case FormatMarkdown:
+		writeMarkdown(&b, pages)
+	case FormatLayout:
+		writeLayout(&b, pages)
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+	return b.String(), nil
+}
+
+func writeText(b *bytes.Buffer, pages [][]Line) {
+	for i, page := range pages {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		for _, line := range page {
+			b.WriteString(line.Text + "\n")
+		}
+	}
+}
+
+func writeMarkdown(b *bytes.Buffer, pages [][]Line) {
+	levels := headingLevels(pages)
+
+	var paragraph []string
+	endParagraph := func() {
+		if len(paragraph) > 0 {
+			b.WriteString(ptext.JoinCJK(strings.Join(paragraph, " ")) + "\n\n")
+			paragraph = nil
+		}
+	}
+
+	for i, page := range pages {
+		endParagraph()
+		fmt.Fprintf(b, "<!-- page %d -->\n\n", i+1)
+
+		var previous *Line
+		for j := range page {
+			line := &page[j]
+
+			if level := levels[size(line.FontSize)]; level > 0 && len(line.Text) <= 120 {
+				// Titles spanning several lines are a single heading.
+				if previous != nil && size(previous.FontSize) == size(line.FontSize) && previous.Y-line.Y <= previous.FontSize*1.5 && len(paragraph) == 0 {
+					b.Truncate(b.Len() - 2)
+					last, _ := utf8.DecodeLastRune(b.Bytes())
+					joined := ptext.JoinCJK(string(last) + " " + line.Text)
+					b.WriteString(strings.TrimPrefix(joined, string(last)) + "\n\n")
+				} else {
+					endParagraph()
+					fmt.Fprintf(b, "%s %s\n\n", strings.Repeat("#", level), line.Text)
+				}
+				previous = line
+				continue
+			}
+
+			if previous != nil && levels[size(previous.FontSize)] > 0 {
+				previous = nil
+			}
+			if previous != nil && previous.Y-line.Y > previous.FontSize*1.8 {
+				endParagraph()
+			}
+
+			text := line.Text
+			if bullet, ok := strings.CutPrefix(text, "•"); ok {
+				endParagraph()
+				text = "-" + bullet
+				if !strings.HasPrefix(bullet, " ") {
+					text = "- " + bullet
+				}
+			}
+			paragraph = append(paragraph, text)
+			previous = line
+		}
+	}
+	endParagraph()
+}
+
+// size rounds a font size, so sizes that only differ by the rounding errors
+// of the PDF are the same.
+func size(fontSize float64) float64 {
+	return math.Round(fontSize*2) / 2
+}
+
+// headingLevels maps the font sizes larger than the one of the body text to
+// heading levels, the largest being 1.
+func headingLevels(pages [][]Line) map[float64]int {
+	body := bodySize(pages)
+
+	larger := []float64{}
+	seen := map[float64]bool{}
+	for _, page := range pages {
+		for _, line := range page {
+			fontSize := size(line.FontSize)
+			if fontSize >= body*1.15 && !seen[fontSize] {
+				larger = append(larger, fontSize)
+				seen[fontSize] = true
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(larger)))
+
+	levels := map[float64]int{}
+	for i, fontSize := range larger {
+		levels[fontSize] = min(i+1, 6)
+	}
+	return levels
+}
+
+// bodySize returns the font size of the body text, the one most characters
+// are set in.
+func bodySize(pages [][]Line) float64 {
+	counts := map[float64]int{}
+	for _, page := range pages {
+		for _, line := range page {
+			counts[size(line.FontSize)] += len(line.Text)
+		}
+	}
+
+	body, most := 0.0, 0
+	for fontSize, count := range counts {
+		if count > most || (count == most && fontSize < body) {
+			body, most = fontSize, count
+		}
+	}
+	return body
+}
+
+func writeLayout(b *bytes.Buffer, pages [][]Line) {
+	for i, page := range pages {
+		if i > 0 {
+			b.WriteString("\f")
+		}
+		if len(page) == 0 {
+			continue
+		}
+
+		// Columns are as wide as the average character of the page.
+		left, width, chars := math.Inf(1), 0.0, 0
+		for _, line := range page {
+			for _, text := range line.texts {
+				left = math.Min(left, text.X)
+				width += text.W
+				chars += len([]rune(text.S))
+			}
+		}
+		if chars == 0 || width == 0 {
+			continue
+		}
+		width /= float64(chars)
+		body := bodySize([][]Line{page})
+
+		var previous *Line
+		for j := range page {
+			line := &page[j]
+
+			// Keep the blank lines between blocks of text.
+			if previous != nil && previous.Y-line.Y > previous.FontSize*1.8 {
+				b.WriteString("\n")
+			}
+
+			row := []rune{}
+			for k, text := range line.texts {
+				// Only words are placed, their characters follow each other.
+				if k > 0 {
+					previous := line.texts[k-1]
+					if text.X-(previous.X+previous.W) <= previous.FontSize*0.15 {
+						row = append(row, []rune(text.S)...)
+						continue
+					}
+					row = append(row, ' ')
+
+					// Larger text is wider than the columns, the gaps between
+					// its words are kept instead of their positions.
+					if size(line.FontSize) > body*1.15 {
+						gap := int(math.Round((text.X - (previous.X + previous.W)) / width))
+						for ; gap > 1; gap-- {
+							row = append(row, ' ')
+						}
+						row = append(row, []rune(text.S)...)
+						continue
+					}
+				}
+
+				column := int(math.Round((text.X - left) / width))
+				for len(row) < column {
+					row = append(row, ' ')
+				}
+				row = append(row, []rune(text.S)...)
+			}
+			b.WriteString(strings.TrimRight(string(row), " ") + "\n")
+			previous = line
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+
+	"github.com/cloudbridgeuy/puper/pkg/dates"
+	"github.com/cloudbridgeuy/puper/pkg/errors"
+	phtml "github.com/cloudbridgeuy/puper/pkg/html"
+	"github.com/cloudbridgeuy/puper/pkg/markdown"
+	"github.com/cloudbridgeuy/puper/pkg/office"
+	"github.com/cloudbridgeuy/puper/pkg/outline"
+	"github.com/cloudbridgeuy/puper/pkg/pdf"
+	"github.com/cloudbridgeuy/puper/pkg/route"
+	"github.com/cloudbridgeuy/puper/pkg/script"
+	"github.com/cloudbridgeuy/puper/pkg/transform"
+)
+
+// Source is a document waiting to be processed, usually HTML.
+type Source struct {
+	Reader  io.Reader
+	Charset string
+	// URL is where the document was fetched from, if known.
+	URL string
+	// FetchedAt is when the document was fetched, if known.
+	FetchedAt time.Time
+	// ContentType is the Content-Type the document was served with, if known.
+	ContentType string
+}
+
+// ErrNoMatch is returned when the selectors and their fallbacks match zero
+// nodes and the policy asks to fail.
+var ErrNoMatch = fmt.Errorf("the selectors matched zero nodes")
+
+// NoMatchPolicy tells what to do when the selectors match zero nodes.
+type NoMatchPolicy struct {
+	// Fallbacks are the selectors tried, in order, until one of them matches.
+	Fallbacks [][]string
+	// Fail makes the document fail with ErrNoMatch when nothing matched.
+	Fail bool
+}
+
+// ParseNoMatchPolicy parses the `error`, `empty` and `fallback:SELECTOR`
+// actions. The parts of a fallback selector are separated by spaces, as in
+// `fallback:div > p`.
+func ParseNoMatchPolicy(actions []string) (NoMatchPolicy, error) {
+	policy := NoMatchPolicy{}
+	for _, action := range actions {
+		switch {
+		case action == "error":
+			policy.Fail = true
+		case action == "empty":
+			policy.Fail = false
+		case strings.HasPrefix(action, "fallback:"):
+			selector := strings.Fields(strings.TrimPrefix(action, "fallback:"))
+			if len(selector) == 0 {
+				return policy, fmt.Errorf("empty fallback selector")
+			}
+			for _, s := range selector {
+				if err := phtml.ValidateSelector(s); err != nil {
+					return policy, fmt.Errorf("invalid fallback selector %q: %w", s, err)
+				}
+			}
+			policy.Fallbacks = append(policy.Fallbacks, selector)
+		default:
+			return policy, fmt.Errorf("unsupported action: %s, expected error, empty or fallback:SELECTOR", action)
+		}
+	}
+	return policy, nil
+}
+
+// Options configures how a document gets processed.
+type Options struct {
+	// Route detects the documents that aren't HTML, like JSON or plain text.
+	// Office documents and PDFs are detected either way.
+	Route bool
+	// PDF is the format of the text of PDF documents: text or layout. Their
+	// markdown is always rendered.
+	PDF       string
+	Selectors []string
+	OnNoMatch NoMatchPolicy
+	// Sections keeps only the sections of the selected nodes whose heading
+	// matches the pattern.
+	Sections   *regexp.Regexp
+	Transforms []transform.Transform
+	// NormalizeDates rewrites the `<time>` elements and the date metadata in
+	// ISO 8601.
+	NormalizeDates bool
+	// Script is the path of a Starlark script run after the transforms.
+	Script string
+	// Markdown configures the markdown and text rendering of HTML documents.
+	// Its source is set to the URL of each document, and the other kinds of
+	// documents get cited once when it cites a source.
+	Markdown markdown.Options
+}
+
+// Stats describes the work done to process a document.
+type Stats struct {
+	// Bytes is the size of the source read.
+	Bytes int64
+	// Nodes is the number of nodes left to print.
+	Nodes int
+	// Duration is the time spent processing the document.
+	Duration time.Duration
+}
+
+// Link is a `<link>` element of the head of a document.
+type Link struct {
+	Rel   string
+	Href  string
+	Type  string
+	Sizes string
+}
+
+// Result is the outcome of processing a document. Output encoders should
+// derive everything they print from it.
+type Result struct {
+	// Kind is the kind of the document, one of the kinds of the route
+	// package. Only HTML documents have a title, metadata and nodes.
+	Kind      string
+	FinalURL  string
+	FetchedAt time.Time
+	Title     string
+	// Metadata holds the `<meta>` tags of the document, keyed by their name or
+	// property.
+	Metadata map[string]string
+	Links    []Link
+	Nodes    []*html.Node
+	// Markdown and Text are the rendered nodes, or the rendered document when
+	// it isn't HTML: PDFs in their format, JSON and XML indented.
+	Markdown string
+	Text     string
+	Stats    Stats
+	Warnings []string
+}
+
+// Process parses the source, runs the selectors, transforms and script over
+// it and returns the result. Office documents get converted to HTML first,
+// and PDFs and the documents routed away from HTML only get rendered. Errors
+// are tagged with the stage they happened in.
+func Process(ctx context.Context, source Source, o Options) (*Result, error) {
+	start := time.Now()
+	counter := &countingReader{r: source.Reader}
+
+	result := &Result{
+		Kind:      route.HTML,
+		FinalURL:  source.URL,
+		FetchedAt: source.FetchedAt,
+		Metadata:  map[string]string{},
+		Links:     []Link{},
+		Warnings:  []string{},
+	}
+
+	cs := source.Charset
+	if _, name := charset.Lookup(cs); cs != "" && name == "" {
+		result.warn("unsupported charset %s, fell back to UTF-8", cs)
+		cs = "utf-8"
+	}
+
+	buffered := bufio.NewReader(counter)
+	peek, _ := buffered.Peek(1024)
+	var reader io.Reader = buffered
+
+	if office.IsZip(peek) {
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, errors.NewPuperError(err, "Can't read the document").WithStage(errors.StageParse).WithURL(source.URL)
+		}
+		reader = bytes.NewReader(body)
+
+		if kind := office.Detect(source.ContentType, body); kind != "" {
+			converted, err := office.ToHTML(body, kind)
+			if err != nil {
+				return nil, errors.NewPuperError(err, "Can't convert the "+kind+" document").WithStage(errors.StageParse).WithURL(source.URL)
+			}
+			reader = bytes.NewReader(converted)
+			cs = "utf-8"
+		}
+	}
+
+	if o.Route || pdf.IsPDF(source.ContentType, peek) {
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, errors.NewPuperError(err, "Can't read the document").WithStage(errors.StageParse).WithURL(source.URL)
+		}
+
+		if kind := route.Detect(source.ContentType, body); kind != route.HTML {
+			result.Kind = kind
+			if err := result.render(body, o.PDF); err != nil {
+				return nil, errors.NewPuperError(err, "Can't convert the "+kind+" document").WithStage(errors.StageConvert).WithURL(source.URL)
+			}
+			if o.Markdown.Cite != "" && o.Markdown.Cite != markdown.CiteNone && source.URL != "" {
+				citation := markdown.Citation(source.URL, source.FetchedAt)
+				if result.Markdown != "" {
+					result.Markdown += "\n\n" + citation
+				}
+				if result.Text != "" {
+					result.Text += "\n\n" + citation
+				}
+			}
+			result.Stats = Stats{Bytes: counter.n, Duration: time.Since(start)}
+			return result, nil
+		}
+		reader = bytes.NewReader(body)
+	}
+
+	root, err := phtml.ParseHTML(ctx, reader, cs)
+	if err != nil {
+		return nil, errors.NewPuperError(err, "Can't get the html document").WithStage(errors.StageParse).WithURL(source.URL)
+	}
+
+	result.Title, result.Metadata, result.Links = head(root)
+
+	result.Nodes, err = phtml.Get(ctx, root, o.Selectors)
+	if err != nil {
+		return nil, errors.NewPuperError(err, "Can't run selectors on root").WithStage(errors.StageSelect).WithURL(source.URL)
+	}
+
+	if len(result.Nodes) == 0 {
+		result.warn("selector %s matched zero nodes", strings.Join(o.Selectors, " "))
+
+		for _, fallback := range o.OnNoMatch.Fallbacks {
+			result.Nodes, err = phtml.Get(ctx, root, fallback)
+			if err != nil {
+				return nil, errors.NewPuperError(err, "Can't run the fallback selector").WithStage(errors.StageSelect).WithURL(source.URL)
+			}
+			if len(result.Nodes) > 0 {
+				break
+			}
+			result.warn("fallback selector %s matched zero nodes", strings.Join(fallback, " "))
+		}
+	}
+
+	if len(result.Nodes) == 0 && o.OnNoMatch.Fail {
+		return nil, errors.NewPuperError(ErrNoMatch, "Nothing to extract").WithStage(errors.StageSelect).WithURL(source.URL)
+	}
+
+	if o.Sections != nil {
+		result.Nodes = outline.Sections(result.Nodes, o.Sections)
+		if len(result.Nodes) == 0 {
+			result.warn("no section heading matches %s", o.Sections)
+		}
+	}
+
+	if o.NormalizeDates {
+		dates.NormalizeNodes(result.Nodes)
+		dates.NormalizeMetadata(result.Metadata)
+	}
+
+	result.Nodes, err = transform.Apply(ctx, result.Nodes, o.Transforms)
+	if err != nil {
+		return nil, errors.NewPuperError(err, "A transform failed").WithStage(errors.StageConvert).WithURL(source.URL)
+	}
+
+	if o.Script != "" {
+		page := script.Page{URL: source.URL, Root: root, Selected: result.Nodes}
+		result.Nodes, err = script.Run(ctx, o.Script, page)
+		if err != nil {
+			return nil, errors.NewPuperError(err, "The script failed").WithStage(errors.StageConvert).WithURL(source.URL)
+		}
+	}
+
+	for _, src := range iframes(result.Nodes) {
+		result.warn("iframe skipped, its content isn't fetched: %s", src)
+	}
+
+	mo := o.Markdown
+	mo.URL = source.URL
+	mo.FetchedAt = source.FetchedAt
+	result.Markdown = markdown.Render(result.Nodes, mo)
+	result.Text = markdown.Text(result.Nodes, mo)
+
+	result.Stats = Stats{
+		Bytes:    counter.n,
+		Nodes:    len(result.Nodes),
+		Duration: time.Since(start),
+	}
+
+	return result, nil
+}
+
+// render renders a document that isn't HTML as markdown and text.
+func (r *Result) render(body []byte, pdfFormat string) error {
+	if r.Kind == route.PDF {
+		pages, err := pdf.Pages(body)
+		if err != nil {
+			return err
+		}
+		if r.Markdown, err = pdf.Render(pages, pdf.FormatMarkdown); err != nil {
+			return err
+		}
+		if pdfFormat == "" || pdfFormat == pdf.FormatMarkdown {
+			pdfFormat = pdf.FormatText
+		}
+		r.Text, err = pdf.Render(pages, pdfFormat)
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := route.Write(&b, r.Kind, body); err != nil {
+		return err
+	}
+	r.Text = b.String()
+
+	r.Markdown = r.Text
+	if r.Kind == route.JSON || r.Kind == route.XML {
+		r.Markdown = "```" + r.Kind + "\n" + strings.TrimRight(r.Text, "\n") + "\n```\n"
+	}
+	return nil
+}
+
+// warn records a non-fatal issue found while processing the document.
+func (r *Result) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// iframes returns the source of the `<iframe>` elements found in the nodes.
+func iframes(nodes []*html.Node) []string {
+	sources := []string{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Iframe {
+			src := "(no src)"
+			for _, a := range n.Attr {
+				if a.Key == "src" {
+					src = a.Val
+				}
+			}
+			sources = append(sources, src)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+
+	return sources
+}
+
+// head returns the title, the `<meta>` tags and the `<link>` elements of the
+// document.
+func head(root *html.Node) (string, map[string]string, []Link) {
+	title := ""
+	metadata := map[string]string{}
+	links := []Link{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if title == "" && n.FirstChild != nil {
+					title = strings.TrimSpace(n.FirstChild.Data)
+				}
+			case atom.Meta:
+				var key, content string
+				for _, a := range n.Attr {
+					switch a.Key {
+					case "name", "property":
+						key = a.Val
+					case "content":
+						content = a.Val
+					}
+				}
+				if key != "" {
+					metadata[key] = content
+				}
+			case atom.Link:
+				link := Link{}
+				for _, a := range n.Attr {
+					switch a.Key {
+					case "rel":
+						link.Rel = strings.ToLower(strings.TrimSpace(a.Val))
+					case "href":
+						link.Href = strings.TrimSpace(a.Val)
+					case "type":
+						link.Type = a.Val
+					case "sizes":
+						link.Sizes = a.Val
+					}
+				}
+				if link.Rel != "" && link.Href != "" {
+					links = append(links, link)
+				}
+			case atom.Body:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	return title, metadata, links
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNoMatchPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []string
+		want    NoMatchPolicy
+		wantErr bool
+	}{
+		{name: "none", actions: nil, want: NoMatchPolicy{}},
+		{name: "error", actions: []string{"error"}, want: NoMatchPolicy{Fail: true}},
+		{name: "empty", actions: []string{"empty"}, want: NoMatchPolicy{}},
+		{name: "last one wins", actions: []string{"error", "empty"}, want: NoMatchPolicy{}},
+		{
+			name:    "fallback",
+			actions: []string{"fallback:article"},
+			want:    NoMatchPolicy{Fallbacks: [][]string{{"article"}}},
+		},
+		{
+			name:    "fallback with parts",
+			actions: []string{"fallback:div > p"},
+			want:    NoMatchPolicy{Fallbacks: [][]string{{"div", ">", "p"}}},
+		},
+		{
+			name:    "fallbacks in order then error",
+			actions: []string{"fallback:main", "fallback:body", "error"},
+			want:    NoMatchPolicy{Fallbacks: [][]string{{"main"}, {"body"}}, Fail: true},
+		},
+		{name: "empty fallback", actions: []string{"fallback:"}, wantErr: true},
+		{name: "blank fallback", actions: []string{"fallback:   "}, wantErr: true},
+		{name: "invalid fallback selector", actions: []string{"fallback:div[class"}, wantErr: true},
+		{name: "unknown action", actions: []string{"skip"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNoMatchPolicy(tt.actions)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseNoMatchPolicy(%q) = %+v, want an error", tt.actions, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNoMatchPolicy(%q) returned %v", tt.actions, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseNoMatchPolicy(%q) = %+v, want %+v", tt.actions, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/cloudbridgeuy/puper/pkg/pdf"
+)
+
+// Kinds of documents.
+const (
+	HTML = "html"
+	JSON = "json"
+	XML  = "xml"
+	PDF  = "pdf"
+	Text = "text"
+)
+
+// Detect returns the kind of the document from its Content-Type, or from its
+// first bytes when the type is unknown. Documents that look like nothing else
+// are HTML.
+func Detect(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return HTML
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return JSON
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return XML
+	case mediaType == "application/pdf":
+		return PDF
+	case strings.HasPrefix(mediaType, "text/"):
+		return Text
+	}
+
+	head := bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return PDF
+	case (bytes.HasPrefix(head, []byte("{")) || bytes.HasPrefix(head, []byte("["))) && json.Valid(body):
+		return JSON
+	case bytes.HasPrefix(head, []byte("<?xml")) && !bytes.Contains(bytes.ToLower(head), []byte("<html")):
+		return XML
+	case bytes.HasPrefix(head, []byte("<")):
+		return HTML
+	case strings.HasPrefix(http.DetectContentType(body), "text/plain"):
+		return Text
+	}
+	return HTML
+}
+
+// Write writes a document that isn't HTML: JSON gets indented, XML gets
+// parsed and indented, PDF gets its text extracted and text passes through.
+func Write(w io.Writer, kind string, body []byte) error {
+	switch kind {
+	case JSON:
+		return writeJSON(w, body)
+	case XML:
+		return writeXML(w, body)
+	case PDF:
+		return pdf.Write(w, body, pdf.FormatText)
+	case Text:
+		return writeText(w, body)
+	}
+	return fmt.Errorf("unsupported document kind: %s", kind)
+}
+
+func writeJSON(w io.Writer, body []byte) error {
+	var b bytes.Buffer
+	if err := json.Indent(&b, body, "", "  "); err != nil {
+		return err
+	}
+	b.WriteString("\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+func writeXML(w io.Writer, body []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+
+	var b bytes.Buffer
+	encoder := xml.NewEncoder(&b)
+	encoder.Indent("", "  ")
+
+	for {
+		// Raw tokens keep the namespace prefixes, which the encoder would
+		// otherwise turn into xmlns attributes.
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.ProcInst:
+			// The encoder doesn't put a newline after the declaration.
+			if t.Target == "xml" {
+				if err := encoder.Flush(); err != nil {
+					return err
+				}
+				fmt.Fprintf(&b, "<?xml %s?>\n", t.Inst)
+				continue
+			}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		case xml.StartElement:
+			t.Name = prefixed(t.Name)
+			attrs := []xml.Attr{}
+			for _, attr := range t.Attr {
+				attrs = append(attrs, xml.Attr{Name: prefixed(attr.Name), Value: attr.Value})
+			}
+			t.Attr = attrs
+			token = t
+		case xml.EndElement:
+			t.Name = prefixed(t.Name)
+			token = t
+		}
+
+		if err := encoder.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	b.WriteString("\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// prefixed folds the namespace prefix of a raw name into its local part.
+func prefixed(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+func writeText(w io.Writer, body []byte) error {
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	return nil
+}
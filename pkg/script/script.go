@@ -0,0 +1,189 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"golang.org/x/net/html"
+
+	phtml "github.com/cloudbridgeuy/puper/pkg/html"
+	"github.com/cloudbridgeuy/puper/pkg/logger"
+)
+
+// Entrypoint is the function the script must define. It receives the page and
+// returns the nodes to print, or None to keep the nodes matched by the
+// selectors.
+const Entrypoint = "extract"
+
+// Page is the context the script runs against.
+type Page struct {
+	URL      string
+	Root     *html.Node
+	Selected []*html.Node
+}
+
+// Run executes the Starlark script found at path and calls its `extract(page)`
+// function. The script gets cancelled once the context is done.
+func Run(ctx context.Context, path string, page Page) ([]*html.Node, error) {
+	thread := &starlark.Thread{
+		Name: "puper",
+		Print: func(_ *starlark.Thread, msg string) {
+			logger.Logger.Info(msg, "script", path)
+		},
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	globals, err := starlark.ExecFile(thread, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	extract, ok := globals[Entrypoint].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s must define an %s(page) function", path, Entrypoint)
+	}
+
+	result, err := starlark.Call(thread, extract, starlark.Tuple{newPage(ctx, page)}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return toNodes(result, page.Selected)
+}
+
+// newPage exposes the page to the script as a struct with the `url`, `title`
+// and `selected` fields and a `query(selector)` method.
+func newPage(ctx context.Context, page Page) *starlarkstruct.Struct {
+	title := ""
+	if titles, err := phtml.Get(ctx, page.Root, []string{"title"}); err == nil && len(titles) > 0 {
+		title = strings.TrimSpace(textContent(titles[0]))
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("page"), starlark.StringDict{
+		"url":      starlark.String(page.URL),
+		"title":    starlark.String(title),
+		"selected": fromNodes(ctx, page.Selected),
+		"query":    queryBuiltin(ctx, "query", page.Root),
+	})
+}
+
+// toNodes converts the value returned by the script.
+func toNodes(value starlark.Value, fallback []*html.Node) ([]*html.Node, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return fallback, nil
+	case *node:
+		return []*html.Node{v.n}, nil
+	case starlark.Indexable:
+		nodes := []*html.Node{}
+		for i := 0; i < v.Len(); i++ {
+			n, ok := v.Index(i).(*node)
+			if !ok {
+				return nil, fmt.Errorf("%s returned a %s where a node was expected", Entrypoint, v.Index(i).Type())
+			}
+			nodes = append(nodes, n.n)
+		}
+		return nodes, nil
+	default:
+		return nil, fmt.Errorf("%s must return a node, a list of nodes or None, got %s", Entrypoint, value.Type())
+	}
+}
+
+func fromNodes(ctx context.Context, nodes []*html.Node) *starlark.List {
+	values := make([]starlark.Value, 0, len(nodes))
+	for _, n := range nodes {
+		values = append(values, &node{ctx, n})
+	}
+	return starlark.NewList(values)
+}
+
+// queryBuiltin runs a selector, written with spaces between its parts as in
+// `div > p`, from the given root.
+func queryBuiltin(ctx context.Context, name string, root *html.Node) *starlark.Builtin {
+	return starlark.NewBuiltin(name, func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var selector string
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "selector", &selector); err != nil {
+			return nil, err
+		}
+
+		nodes, err := phtml.Get(ctx, root, strings.Fields(selector))
+		if err != nil {
+			return nil, err
+		}
+		return fromNodes(ctx, nodes), nil
+	})
+}
+
+// node exposes an HTML node to the script.
+type node struct {
+	ctx context.Context
+	n   *html.Node
+}
+
+func (n *node) String() string        { return "<node " + n.n.Data + ">" }
+func (n *node) Type() string          { return "node" }
+func (n *node) Freeze()               {}
+func (n *node) Truth() starlark.Bool  { return starlark.True }
+func (n *node) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: node") }
+
+// AttrNames lists the fields and methods of a node.
+func (n *node) AttrNames() []string {
+	return []string{"attr", "html", "query", "tag", "text"}
+}
+
+// Attr returns a field or method of the node.
+func (n *node) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "tag":
+		return starlark.String(n.n.Data), nil
+	case "text":
+		return starlark.String(strings.TrimSpace(textContent(n.n))), nil
+	case "html":
+		var b strings.Builder
+		if err := html.Render(&b, n.n); err != nil {
+			return nil, err
+		}
+		return starlark.String(b.String()), nil
+	case "query":
+		return queryBuiltin(n.ctx, "query", n.n), nil
+	case "attr":
+		return starlark.NewBuiltin("attr", func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			var fallback starlark.Value = starlark.None
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &key, "default?", &fallback); err != nil {
+				return nil, err
+			}
+			for _, a := range n.n.Attr {
+				if a.Key == key {
+					return starlark.String(a.Val), nil
+				}
+			}
+			return fallback, nil
+		}), nil
+	}
+	return nil, nil
+}
+
+// textContent concatenates the text of the node and its descendants.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,214 @@
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// Credentials are the AWS access keys requests are signed with.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+}
+
+// FromEnvironment returns the credentials of the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables or, when they're
+// unset, of the AWS_PROFILE profile of the shared credentials file, the
+// default one if unset.
+func FromEnvironment() (Credentials, error) {
+	c := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.AccessKeyID != "" && c.SecretAccessKey != "" {
+		return c, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return c, err
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	file, err := ini.Load(path)
+	if err != nil {
+		return c, fmt.Errorf("no AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, and can't read %s: %w", path, err)
+	}
+	section, err := file.GetSection(profile)
+	if err != nil {
+		return c, fmt.Errorf("no %s profile in %s", profile, path)
+	}
+
+	c = Credentials{
+		AccessKeyID:     section.Key("aws_access_key_id").String(),
+		SecretAccessKey: section.Key("aws_secret_access_key").String(),
+		SessionToken:    section.Key("aws_session_token").String(),
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return c, fmt.Errorf("the %s profile of %s has no aws_access_key_id or aws_secret_access_key", profile, path)
+	}
+	return c, nil
+}
+
+// Signer signs the requests to an AWS service with Signature Version 4.
+type Signer struct {
+	Credentials Credentials
+	Service     string
+	Region      string
+}
+
+// Parse returns the service and region of a `SERVICE:REGION` value, like
+// `execute-api:us-east-1`.
+func Parse(value string) (service, region string, err error) {
+	service, region, ok := strings.Cut(value, ":")
+	if !ok || service == "" || region == "" {
+		return "", "", fmt.Errorf("expected SERVICE:REGION, like execute-api:us-east-1")
+	}
+	return service, region, nil
+}
+
+// Sign adds the Authorization header to a request without a body, along
+// with the X-Amz headers it signs.
+func (s Signer) Sign(r *http.Request) error {
+	return s.sign(r, time.Now())
+}
+
+func (s Signer) sign(r *http.Request, now time.Time) error {
+	if r.Body != nil && r.Body != http.NoBody {
+		return fmt.Errorf("can't sign a request with a body")
+	}
+
+	now = now.UTC()
+	date := now.Format("20060102")
+	payload := hash("")
+
+	r.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	r.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.Credentials.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for _, name := range []string{"X-Amz-Content-Sha256", "X-Amz-Date", "X-Amz-Security-Token"} {
+		if value := r.Header.Get(name); value != "" {
+			headers[strings.ToLower(name)] = value
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	// Every service but S3 expects the path to be encoded twice.
+	if s.Service != "s3" {
+		path = escapePath(path)
+	}
+
+	request := strings.Join([]string{
+		r.Method,
+		path,
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hash(request)
+
+	key := mac([]byte("AWS4"+s.Credentials.SecretAccessKey), date)
+	key = mac(key, s.Region)
+	key = mac(key, s.Service)
+	key = mac(key, "aws4_request")
+
+	r.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.Credentials.AccessKeyID, scope, signedHeaders, hex.EncodeToString(mac(key, toSign)),
+	))
+	return nil
+}
+
+// canonicalQuery returns the parameters sorted by name and value, encoded
+// the way AWS expects.
+func canonicalQuery(query url.Values) string {
+	params := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, escape(name)+"="+escape(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// escapePath escapes the segments of the path, keeping the slashes.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// escape percent-encodes everything but the unreserved characters of
+// RFC 3986.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func mac(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
@@ -0,0 +1,162 @@
+package text
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Filter transforms the text of the document before it gets printed.
+type Filter func(string) string
+
+// Chain returns a filter running the filters in order, for the outputs
+// that print their text in one go.
+func Chain(filters []Filter) Filter {
+	return func(s string) string {
+		for _, filter := range filters {
+			s = filter(s)
+		}
+		return s
+	}
+}
+
+// nbspReplacer maps the non-breaking space variants to a regular space.
+var nbspReplacer = strings.NewReplacer(
+	"\u00a0", " ", // no-break space
+	"\u2007", " ", // figure space
+	"\u202f", " ", // narrow no-break space
+)
+
+// Normalize returns a filter that applies the given Unicode normalization
+// form. Only the composed forms, NFC and NFKC, are supported.
+func Normalize(form string) (Filter, error) {
+	switch strings.ToUpper(form) {
+	case "NFC":
+		return norm.NFC.String, nil
+	case "NFKC":
+		return norm.NFKC.String, nil
+	default:
+		return nil, fmt.Errorf("unsupported normalization form: %s", form)
+	}
+}
+
+// ReplaceNbsp replaces non-breaking spaces with regular spaces.
+func ReplaceNbsp(s string) string {
+	return nbspReplacer.Replace(s)
+}
+
+// punctuationReplacer maps typographic punctuation to its ASCII equivalent.
+var punctuationReplacer = strings.NewReplacer(
+	"‘", "'", // left single quotation mark
+	"’", "'", // right single quotation mark
+	"‚", "'", // single low-9 quotation mark
+	"‛", "'", // single high-reversed-9 quotation mark
+	"′", "'", // prime
+	"“", `"`, // left double quotation mark
+	"”", `"`, // right double quotation mark
+	"„", `"`, // double low-9 quotation mark
+	"‟", `"`, // double high-reversed-9 quotation mark
+	"″", `"`, // double prime
+	"«", `"`, // left-pointing double angle quotation mark
+	"»", `"`, // right-pointing double angle quotation mark
+	"‐", "-", // hyphen
+	"‑", "-", // non-breaking hyphen
+	"‒", "-", // figure dash
+	"–", "-", // en dash
+	"—", "--", // em dash
+	"―", "--", // horizontal bar
+	"−", "-", // minus sign
+	"…", "...", // horizontal ellipsis
+)
+
+// AsciiPunctuation replaces curly quotes, dashes and ellipses with their
+// ASCII equivalents.
+func AsciiPunctuation(s string) string {
+	return punctuationReplacer.Replace(s)
+}
+
+// isCJK reports whether the rune belongs to the scripts written without
+// spaces between words, Chinese and Japanese, or is one of their punctuation
+// marks. Korean separates its words with spaces.
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		r >= 0x3000 && r <= 0x30ff || // punctuation, hiragana and katakana
+		r >= 0x31f0 && r <= 0x31ff || // katakana phonetic extensions
+		r >= 0xff00 && r <= 0xffef // full and half width forms
+}
+
+// JoinCJK removes the whitespace between two CJK characters, which only comes
+// from the line breaks of the source, or from joining its text nodes. The
+// other whitespace is left as it is, and so are the ideographic and the
+// non-breaking spaces.
+func JoinCJK(s string) string {
+	var b strings.Builder
+	var previous rune
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if !isASCIISpace(runes[i]) {
+			b.WriteRune(runes[i])
+			previous = runes[i]
+			continue
+		}
+
+		end := i
+		for end < len(runes) && isASCIISpace(runes[end]) {
+			end++
+		}
+		if !(isCJK(previous) && end < len(runes) && isCJK(runes[end])) {
+			b.WriteString(string(runes[i:end]))
+		}
+		i = end - 1
+	}
+	return b.String()
+}
+
+func isASCIISpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+// RedactPatterns holds the built-in patterns available to Redact.
+var RedactPatterns = map[string]string{
+	"email": `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"phone": `(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)[\s.-]?|\b\d{2,4}[\s.-])\d{3,4}[\s.-]\d{3,4}\b`,
+	"ssn":   `\b\d{3}-\d{2}-\d{4}\b`,
+}
+
+// Redact returns a filter that replaces the matches of each named pattern
+// with a `[NAME]` placeholder. The patterns are applied in the given order,
+// and custom patterns take precedence over the built-in ones.
+func Redact(names []string, custom map[string]string) (Filter, error) {
+	type redaction struct {
+		re          *regexp.Regexp
+		placeholder string
+	}
+
+	redactions := []redaction{}
+	for _, name := range names {
+		pattern, ok := custom[name]
+		if !ok {
+			pattern, ok = RedactPatterns[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction pattern: %s", name)
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", name, err)
+		}
+
+		redactions = append(redactions, redaction{re, "[" + strings.ToUpper(name) + "]"})
+	}
+
+	return func(s string) string {
+		for _, r := range redactions {
+			s = r.re.ReplaceAllLiteralString(s, r.placeholder)
+		}
+		return s
+	}, nil
+}
@@ -0,0 +1,70 @@
+package text
+
+import "testing"
+
+func TestJoinCJK(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"latin", "hello  world\n", "hello  world\n"},
+		{"han line break", "日本語の\n文章です", "日本語の文章です"},
+		{"kana spaces", "ひらがな \t カタカナ", "ひらがなカタカナ"},
+		{"hangul spaces kept", "한국어 문장", "한국어 문장"},
+		{"cjk and latin", "日本 Tokyo 東京", "日本 Tokyo 東京"},
+		{"cjk punctuation", "こんにちは。 \n元気です", "こんにちは。元気です"},
+		{"ideographic space kept", "日本　語", "日本　語"},
+		{"nbsp kept", "日本 語", "日本 語"},
+		{"leading and trailing", " 日本語 ", " 日本語 "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JoinCJK(tt.in); got != tt.want {
+				t.Errorf("JoinCJK(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		custom  map[string]string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "no patterns", in: "mail me@example.com", want: "mail me@example.com"},
+		{name: "email", names: []string{"email"}, in: "mail john.doe+x@mail.example.org now", want: "mail [EMAIL] now"},
+		{name: "phone", names: []string{"phone"}, in: "call +1 (555) 123-4567 today", want: "call [PHONE] today"},
+		{name: "ssn", names: []string{"ssn"}, in: "ssn 123-45-6789.", want: "ssn [SSN]."},
+		{name: "several", names: []string{"email", "ssn"}, in: "a@b.io 123-45-6789", want: "[EMAIL] [SSN]"},
+		{name: "custom", names: []string{"token"}, custom: map[string]string{"token": `tok_[a-z0-9]+`}, in: "key tok_abc123", want: "key [TOKEN]"},
+		{name: "custom overrides built-in", names: []string{"email"}, custom: map[string]string{"email": `secret`}, in: "a@b.io secret", want: "a@b.io [EMAIL]"},
+		{name: "placeholder is literal", names: []string{"dollar"}, custom: map[string]string{"dollar": `\d+`}, in: "$1 and 2", want: "$[DOLLAR] and [DOLLAR]"},
+		{name: "unknown pattern", names: []string{"iban"}, wantErr: true},
+		{name: "invalid pattern", names: []string{"bad"}, custom: map[string]string{"bad": `(`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redact, err := Redact(tt.names, tt.custom)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Redact(%v) returned no error", tt.names)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Redact(%v) returned %v", tt.names, err)
+			}
+			if got := redact(tt.in); got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package tor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultProxy is the address of the SOCKS proxy of a local Tor daemon.
+const DefaultProxy = "127.0.0.1:9050"
+
+// NewCircuit asks the Tor daemon listening on the control address to switch
+// to clean circuits, so the run doesn't share them with previous ones.
+func NewCircuit(ctx context.Context, address, password string) error {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(10 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	send := func(command string) error {
+		if _, err := fmt.Fprintf(conn, "%s\r\n", command); err != nil {
+			return err
+		}
+
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasPrefix(reply, "250") {
+			return fmt.Errorf("tor control port replied: %s", strings.TrimSpace(reply))
+		}
+		return nil
+	}
+
+	if err := send(fmt.Sprintf("AUTHENTICATE %q", password)); err != nil {
+		return err
+	}
+
+	return send("SIGNAL NEWNYM")
+}
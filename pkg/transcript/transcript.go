@@ -0,0 +1,147 @@
+package transcript
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Providers of embedded videos.
+const (
+	YouTube = "youtube"
+	Vimeo   = "vimeo"
+)
+
+// Video is a video of a provider.
+type Video struct {
+	Provider string
+	ID       string
+}
+
+// Transcript is the caption track of a video.
+type Transcript struct {
+	Title    string
+	Language string
+	Cues     []Cue
+}
+
+// Cue is a caption of a transcript.
+type Cue struct {
+	Start time.Duration
+	Text  string
+}
+
+// Parse returns the video an embed or a link points to, like
+// `https://www.youtube.com/embed/ID` or `https://player.vimeo.com/video/ID`.
+func Parse(src string) (Video, bool) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return Video{}, false
+	}
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch host {
+	case "youtube.com", "m.youtube.com", "youtube-nocookie.com":
+		if len(segments) == 2 && (segments[0] == "embed" || segments[0] == "shorts" || segments[0] == "live") {
+			return Video{YouTube, segments[1]}, segments[1] != ""
+		}
+		if len(segments) == 1 && segments[0] == "watch" && u.Query().Get("v") != "" {
+			return Video{YouTube, u.Query().Get("v")}, true
+		}
+	case "youtu.be":
+		if len(segments) == 1 && segments[0] != "" {
+			return Video{YouTube, segments[0]}, true
+		}
+	case "player.vimeo.com":
+		if len(segments) == 2 && segments[0] == "video" && isNumber(segments[1]) {
+			return Video{Vimeo, segments[1]}, true
+		}
+	case "vimeo.com":
+		if len(segments) == 1 && isNumber(segments[0]) {
+			return Video{Vimeo, segments[0]}, true
+		}
+	}
+	return Video{}, false
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch downloads the caption track of the video in the language, or in the
+// first language available when there is none in it. Tracks written by the
+// uploader are preferred over the generated ones.
+func Fetch(ctx context.Context, client *http.Client, v Video, language string) (*Transcript, error) {
+	switch v.Provider {
+	case YouTube:
+		return fetchYouTube(ctx, client, v.ID, language)
+	case Vimeo:
+		return fetchVimeo(ctx, client, v.ID, language)
+	}
+	return nil, fmt.Errorf("unsupported provider: %s", v.Provider)
+}
+
+// track is a caption track offered by a provider.
+type track struct {
+	url       string
+	language  string
+	generated bool
+}
+
+// pick returns the track in the language written by the uploader, else a
+// generated one in the language, else the first track.
+func pick(tracks []track, language string) (track, bool) {
+	if len(tracks) == 0 {
+		return track{}, false
+	}
+
+	var generated *track
+	for i, t := range tracks {
+		if strings.EqualFold(t.language, language) || strings.HasPrefix(strings.ToLower(t.language), strings.ToLower(language)+"-") {
+			if !t.generated {
+				return t, true
+			}
+			if generated == nil {
+				generated = &tracks[i]
+			}
+		}
+	}
+	if generated != nil {
+		return *generated, true
+	}
+	return tracks[0], true
+}
+
+// get downloads the body of the URL.
+func get(ctx context.Context, client *http.Client, u string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The consent page is served instead of the video page without it.
+	request.Header.Set("Cookie", "CONSENT=YES+1")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%s: %s", u, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
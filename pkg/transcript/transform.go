@@ -0,0 +1,161 @@
+package transcript
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/cloudbridgeuy/puper/pkg/transform"
+)
+
+// paragraphLength is how much of the video a paragraph of the transcript
+// covers.
+const paragraphLength = time.Minute
+
+// Transform returns a transform that inserts the transcript of every
+// YouTube or Vimeo video embedded in the nodes after its embed, as a
+// `<section>` with a heading naming the video and one paragraph per minute.
+// Videos without captions, or whose captions can't be downloaded, are
+// skipped with a warning.
+func Transform(ctx context.Context, client *http.Client, language string, logger *log.Logger) transform.Transform {
+	return transform.Func(func(nodes []*html.Node) ([]*html.Node, error) {
+		result := []*html.Node{}
+		for _, n := range nodes {
+			result = append(result, n)
+
+			for _, embed := range embeds(n) {
+				video, _ := Parse(source(embed))
+				logger.Debug("Fetching the transcript", "provider", video.Provider, "id", video.ID)
+
+				t, err := Fetch(ctx, client, video, language)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					logger.Warn("Can't fetch the transcript", "provider", video.Provider, "id", video.ID, "error", err)
+					continue
+				}
+
+				section := t.Node(video)
+				if embed == n || embed.Parent == nil {
+					result = append(result, section)
+				} else {
+					embed.Parent.InsertBefore(section, embed.NextSibling)
+				}
+			}
+		}
+		return result, nil
+	})
+}
+
+// embeds returns the `<iframe>` and `<embed>` elements of the tree
+// showing a supported video.
+func embeds(n *html.Node) []*html.Node {
+	found := []*html.Node{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Iframe, atom.Embed:
+				if _, ok := Parse(source(n)); ok {
+					found = append(found, n)
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// source returns the URL an embed shows, from its `src` attribute or the
+// `data-src` one of lazy loaded embeds.
+func source(n *html.Node) string {
+	var src, dataSrc string
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "src":
+			src = a.Val
+		case "data-src":
+			dataSrc = a.Val
+		}
+	}
+	if src == "" || strings.HasPrefix(src, "about:") {
+		src = dataSrc
+	}
+	if strings.HasPrefix(src, "//") {
+		src = "https:" + src
+	}
+	return src
+}
+
+// Node returns the transcript as a `<section>` labeled with the title of
+// the video, or its provider and ID when it has none.
+func (t *Transcript) Node(v Video) *html.Node {
+	section := element(atom.Section)
+	section.Attr = []html.Attribute{
+		{Key: "class", Val: "transcript"},
+		{Key: "data-provider", Val: v.Provider},
+		{Key: "data-video", Val: v.ID},
+	}
+	if t.Language != "" {
+		section.Attr = append(section.Attr, html.Attribute{Key: "lang", Val: t.Language})
+	}
+
+	label := t.Title
+	if label == "" {
+		label = fmt.Sprintf("%s video %s", v.Provider, v.ID)
+	}
+	heading := element(atom.H2)
+	heading.AppendChild(text("Transcript: " + label))
+	section.AppendChild(heading)
+
+	var p *html.Node
+	var b strings.Builder
+	flush := func() {
+		if p != nil {
+			p.AppendChild(text(b.String()))
+			section.AppendChild(p)
+		}
+		b.Reset()
+	}
+	for i, cue := range t.Cues {
+		if i == 0 || cue.Start/paragraphLength != t.Cues[i-1].Start/paragraphLength {
+			flush()
+			p = element(atom.P)
+			b.WriteString("[" + timestamp(cue.Start) + "] ")
+		} else {
+			b.WriteString(" ")
+		}
+		b.WriteString(cue.Text)
+	}
+	flush()
+
+	return section
+}
+
+// timestamp formats a position in the video like `1:05` or `1:02:05`.
+func timestamp(d time.Duration) string {
+	seconds := int(d.Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func element(a atom.Atom) *html.Node {
+	return &html.Node{Type: html.ElementNode, DataAtom: a, Data: a.String()}
+}
+
+func text(s string) *html.Node {
+	return &html.Node{Type: html.TextNode, Data: s}
+}
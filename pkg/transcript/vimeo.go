@@ -0,0 +1,96 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fetchVimeo reads the text tracks from the player configuration and
+// downloads the chosen one in the WebVTT format.
+func fetchVimeo(ctx context.Context, client *http.Client, id, language string) (*Transcript, error) {
+	data, err := get(ctx, client, "https://player.vimeo.com/video/"+id+"/config")
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Request struct {
+			TextTracks []struct {
+				URL  string `json:"url"`
+				Lang string `json:"lang"`
+				Kind string `json:"kind"`
+			} `json:"text_tracks"`
+		} `json:"request"`
+		Video struct {
+			Title string `json:"title"`
+		} `json:"video"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("can't read the player configuration: %w", err)
+	}
+
+	tracks := []track{}
+	for _, t := range config.Request.TextTracks {
+		u := t.URL
+		if strings.HasPrefix(u, "/") {
+			u = "https://player.vimeo.com" + u
+		}
+		tracks = append(tracks, track{url: u, language: t.Lang, generated: strings.Contains(t.Lang, "autogen")})
+	}
+	chosen, ok := pick(tracks, language)
+	if !ok {
+		return nil, fmt.Errorf("the video has no captions")
+	}
+
+	vtt, err := get(ctx, client, chosen.url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transcript{Title: config.Video.Title, Language: chosen.language, Cues: parseVTT(vtt)}, nil
+}
+
+// parseVTT returns the cues of a WebVTT file.
+func parseVTT(data []byte) []Cue {
+	cues := []Cue{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	var cue *Cue
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.Contains(line, "-->"):
+			start, _, _ := strings.Cut(line, "-->")
+			cue = &Cue{Start: parseTimestamp(strings.TrimSpace(start))}
+		case line == "":
+			if cue != nil && cue.Text != "" {
+				cues = append(cues, *cue)
+			}
+			cue = nil
+		case cue != nil:
+			cue.Text = strings.TrimSpace(cue.Text + " " + line)
+		}
+	}
+	if cue != nil && cue.Text != "" {
+		cues = append(cues, *cue)
+	}
+	return cues
+}
+
+// parseTimestamp parses a WebVTT timestamp like `01:02.500` or
+// `1:01:02.500`.
+func parseTimestamp(s string) time.Duration {
+	var total time.Duration
+	for _, part := range strings.Split(s, ":") {
+		value, _ := strconv.ParseFloat(part, 64)
+		total = total*60 + time.Duration(value*float64(time.Second))
+	}
+	return total
+}
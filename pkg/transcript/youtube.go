@@ -0,0 +1,79 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var youTubeTitle = regexp.MustCompile(`<meta name="title" content="([^"]*)"`)
+
+// fetchYouTube reads the caption tracks from the player response embedded
+// in the watch page, and downloads the chosen one in the timed text format.
+func fetchYouTube(ctx context.Context, client *http.Client, id, language string) (*Transcript, error) {
+	page, err := get(ctx, client, "https://www.youtube.com/watch?v="+id+"&hl="+language)
+	if err != nil {
+		return nil, err
+	}
+
+	start := bytes.Index(page, []byte(`"captionTracks":`))
+	if start < 0 {
+		return nil, fmt.Errorf("the video has no captions")
+	}
+
+	var captions []struct {
+		BaseURL      string `json:"baseUrl"`
+		LanguageCode string `json:"languageCode"`
+		Kind         string `json:"kind"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(page[start+len(`"captionTracks":`):]))
+	if err := decoder.Decode(&captions); err != nil {
+		return nil, fmt.Errorf("can't read the caption tracks: %w", err)
+	}
+
+	tracks := []track{}
+	for _, c := range captions {
+		tracks = append(tracks, track{url: c.BaseURL, language: c.LanguageCode, generated: c.Kind == "asr"})
+	}
+	chosen, ok := pick(tracks, language)
+	if !ok {
+		return nil, fmt.Errorf("the video has no captions")
+	}
+
+	data, err := get(ctx, client, chosen.url)
+	if err != nil {
+		return nil, err
+	}
+
+	var timedText struct {
+		Texts []struct {
+			Start string `xml:"start,attr"`
+			Text  string `xml:",chardata"`
+		} `xml:"text"`
+	}
+	if err := xml.Unmarshal(data, &timedText); err != nil {
+		return nil, fmt.Errorf("can't read the captions: %w", err)
+	}
+
+	transcript := &Transcript{Language: chosen.language}
+	if match := youTubeTitle.FindSubmatch(page); match != nil {
+		transcript.Title = html.UnescapeString(string(match[1]))
+	}
+	for _, text := range timedText.Texts {
+		seconds, _ := strconv.ParseFloat(text.Start, 64)
+		// The captions are escaped once more inside the XML.
+		cue := strings.Join(strings.Fields(html.UnescapeString(text.Text)), " ")
+		if cue != "" {
+			transcript.Cues = append(transcript.Cues, Cue{Start: time.Duration(seconds * float64(time.Second)), Text: cue})
+		}
+	}
+	return transcript, nil
+}
@@ -0,0 +1,53 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Command returns a transform that pipes the serialized HTML of every node
+// through an external command run by `sh -c`, and replaces the node with the
+// nodes parsed from the command output. The command gets killed once the
+// context is done.
+func Command(ctx context.Context, command string) Transform {
+	return Func(func(nodes []*html.Node) ([]*html.Node, error) {
+		result := []*html.Node{}
+		for _, n := range nodes {
+			var source bytes.Buffer
+			if err := html.Render(&source, n); err != nil {
+				return nil, err
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.CommandContext(ctx, "sh", "-c", command)
+			cmd.Stdin = &source
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			if err := cmd.Run(); err != nil {
+				if message := strings.TrimSpace(stderr.String()); message != "" {
+					return nil, fmt.Errorf("%s: %w: %s", command, err, message)
+				}
+				return nil, fmt.Errorf("%s: %w", command, err)
+			}
+
+			context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+			if n.Parent != nil && n.Parent.Type == html.ElementNode {
+				context = n.Parent
+			}
+
+			parsed, err := html.ParseFragment(&stdout, context)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, parsed...)
+		}
+		return result, nil
+	})
+}
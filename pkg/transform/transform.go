@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"plugin"
+
+	"golang.org/x/net/html"
+)
+
+// Transform modifies the selected nodes before they get printed.
+type Transform interface {
+	Transform(nodes []*html.Node) ([]*html.Node, error)
+}
+
+// Func adapts a function to the Transform interface.
+type Func func(nodes []*html.Node) ([]*html.Node, error)
+
+// Transform calls the function.
+func (f Func) Transform(nodes []*html.Node) ([]*html.Node, error) {
+	return f(nodes)
+}
+
+// Symbol is the name a plugin has to export its transform under, either as a
+// variable implementing Transform or as a function with the signature of
+// Func.
+const Symbol = "Transform"
+
+// Load opens the Go plugin found at path and returns its transform. Plugins
+// must be built with `go build -buildmode=plugin` against the same version
+// of puper and its dependencies.
+func Load(path string) (Transform, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	symbol, err := p.Lookup(Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := symbol.(type) {
+	case func([]*html.Node) ([]*html.Node, error):
+		return Func(t), nil
+	case *Transform:
+		return *t, nil
+	case Transform:
+		return t, nil
+	default:
+		return nil, fmt.Errorf("%s: %s has type %T, expected a transform.Transform or a transform.Func", path, Symbol, symbol)
+	}
+}
+
+// Apply runs the transforms over the nodes, in order. It stops with the
+// context error once the context is done.
+func Apply(ctx context.Context, nodes []*html.Node, transforms []Transform) ([]*html.Node, error) {
+	var err error
+	for _, t := range transforms {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if nodes, err = t.Transform(nodes); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}